@@ -0,0 +1,332 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Various constants used for capability negotiation.
+const (
+	capVersion      = "302"
+	capMore         = "*"  // Continuation marker for multiline replies
+	capDisable      = '-'  // Prefix to disable a capability
+	capValue   byte = 0x3D // Separates name and value (=)
+)
+
+// Caps keeps track of available and enabled IRCv3 capabilities.
+//
+// All methods may be used from multiple goroutines.
+type Caps struct {
+	available map[string]string
+	enabled   map[string]bool
+	mu        sync.RWMutex
+}
+
+// NewCaps returns an empty set of capabilities.
+func NewCaps() *Caps {
+	return &Caps{
+		available: make(map[string]string),
+		enabled:   make(map[string]bool),
+	}
+}
+
+// Available returns true if the server advertised the capability.
+func (c *Caps) Available(name string) bool {
+	c.mu.RLock()
+	_, ok := c.available[name]
+	c.mu.RUnlock()
+	return ok
+}
+
+// Value returns the value the server advertised for a capability, such as
+// "PLAIN,EXTERNAL" for "sasl=PLAIN,EXTERNAL".
+func (c *Caps) Value(name string) (value string, ok bool) {
+	c.mu.RLock()
+	value, ok = c.available[name]
+	c.mu.RUnlock()
+	return
+}
+
+// Enabled returns true if the capability was acknowledged by the server.
+func (c *Caps) Enabled(name string) bool {
+	c.mu.RLock()
+	ok := c.enabled[name]
+	c.mu.RUnlock()
+	return ok
+}
+
+// List returns the names of all enabled capabilities, sorted.
+func (c *Caps) List() []string {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.enabled))
+	for name := range c.enabled {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// All returns the names of all available capabilities, sorted.
+func (c *Caps) All() []string {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.available))
+	for name := range c.available {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// add marks capabilities in "name[=value]" notation as available.
+func (c *Caps) add(caps []string) (names []string) {
+	c.mu.Lock()
+	for _, token := range caps {
+		name, value := token, ""
+		if i := indexByte(token, capValue); i >= 0 {
+			name, value = token[:i], token[i+1:]
+		}
+		c.available[name] = value
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+	return names
+}
+
+// remove marks capabilities as unavailable.
+func (c *Caps) remove(names []string) {
+	c.mu.Lock()
+	for _, name := range names {
+		delete(c.available, name)
+		delete(c.enabled, name)
+	}
+	c.mu.Unlock()
+}
+
+// enable marks capabilities as enabled, or disabled if prefixed with '-'.
+func (c *Caps) enable(names []string) {
+	c.mu.Lock()
+	for _, name := range names {
+		if len(name) > 0 && name[0] == capDisable {
+			delete(c.enabled, name[1:])
+		} else {
+			c.enabled[name] = true
+		}
+	}
+	c.mu.Unlock()
+}
+
+// reset disables all capabilities.
+func (c *Caps) reset() {
+	c.mu.Lock()
+	c.enabled = make(map[string]bool)
+	c.mu.Unlock()
+}
+
+// clear forgets all available and enabled capabilities.
+func (c *Caps) clear() {
+	c.mu.Lock()
+	c.available = make(map[string]string)
+	c.enabled = make(map[string]bool)
+	c.mu.Unlock()
+}
+
+// CapNegotiator implements the client side of IRCv3 capability negotiation.
+// See https://ircv3.net/specs/extensions/capability-negotiation
+//
+// Start the negotiation by sending the message returned by Start, then pass
+// every CAP message received from the server to Handle and send the messages
+// it returns. When Done returns true, registration can be completed by
+// sending the message returned by End.
+//
+// The negotiator keeps handling cap-notify NEW and DEL messages after
+// registration. Newly advertised capabilities are requested if wanted.
+//
+// A CapNegotiator is not safe for use by multiple goroutines, but its Caps are.
+type CapNegotiator struct {
+	Caps *Caps
+
+	// Called after the server advertised (NEW) or removed (DEL) capabilities.
+	Notify func(subcommand string, names []string)
+
+	want    []string
+	pending map[string]bool
+	ls      []string // Capabilities from an incomplete multiline LS reply
+	list    bool     // True while receiving a multiline LIST reply
+	done    bool
+}
+
+// NewCapNegotiator returns a CapNegotiator that requests the given
+// capabilities if the server supports them.
+func NewCapNegotiator(want ...string) *CapNegotiator {
+	return &CapNegotiator{
+		Caps:    NewCaps(),
+		want:    want,
+		pending: make(map[string]bool),
+	}
+}
+
+// Start returns the message that starts capability negotiation, CAP LS 302.
+//
+// Start resets the negotiation, so a negotiator can be reused for a new
+// connection. Capabilities of the previous connection are forgotten.
+func (n *CapNegotiator) Start() *Message {
+	n.Caps.clear()
+	n.pending = make(map[string]bool)
+	n.ls = nil
+	n.list = false
+	n.done = false
+	return &Message{Command: CAP, Params: []string{CAP_LS, capVersion}}
+}
+
+// End returns the message that ends capability negotiation, CAP END.
+func (n *CapNegotiator) End() *Message {
+	return &Message{Command: CAP, Params: []string{CAP_END}}
+}
+
+// Done returns true when the server listed its capabilities and replied to
+// all requests.
+func (n *CapNegotiator) Done() bool {
+	return n.done && len(n.pending) <= 0
+}
+
+// Request returns the messages requesting the given capabilities.
+//
+// Capabilities are spread over multiple CAP REQ messages if needed, so the
+// server's replies stay within the line length limit.
+func (n *CapNegotiator) Request(names ...string) (messages []*Message) {
+
+	// The server's reply includes its name and our nickname.
+	limit := maxLength - relayPrefixLength - len("CAP  ACK :")
+
+	var line []string
+	length := 0
+
+	for _, name := range names {
+		if len(line) > 0 && length+1+len(name) > limit {
+			messages = append(messages, n.request(line))
+			line, length = nil, 0
+		}
+		if len(line) > 0 {
+			length++
+		}
+		line = append(line, name)
+		length = length + len(name)
+	}
+
+	if len(line) > 0 {
+		messages = append(messages, n.request(line))
+	}
+
+	return messages
+}
+
+// request returns a single CAP REQ message.
+func (n *CapNegotiator) request(names []string) *Message {
+	for _, name := range names {
+		n.pending[strings.TrimPrefix(name, string(capDisable))] = true
+	}
+	return &Message{Command: CAP, Params: []string{CAP_REQ}, Trailing: strings.Join(names, string(space))}
+}
+
+// Handle processes a CAP message and returns the messages that should be sent
+// in reply. Other messages are ignored.
+func (n *CapNegotiator) Handle(m *Message) []*Message {
+
+	if m.Command != CAP {
+		return nil
+	}
+
+	subcommand, more, caps := capParams(m)
+
+	switch subcommand {
+
+	case CAP_LS:
+		if n.ls = append(n.ls, caps...); more {
+			return nil
+		}
+		n.Caps.add(n.ls)
+		n.ls = nil
+		n.done = true
+		return n.Request(n.wanted()...)
+
+	case CAP_LIST:
+		if !n.list {
+			n.Caps.reset()
+		}
+		n.Caps.enable(caps)
+		n.list = more
+
+	case CAP_ACK:
+		n.Caps.enable(caps)
+		n.settle(caps)
+
+	case CAP_NAK:
+		n.settle(caps)
+
+	case CAP_NEW:
+		names := n.Caps.add(caps)
+		if n.Notify != nil {
+			n.Notify(CAP_NEW, names)
+		}
+		return n.Request(n.wanted()...)
+
+	case CAP_DEL:
+		n.Caps.remove(caps)
+		if n.Notify != nil {
+			n.Notify(CAP_DEL, caps)
+		}
+
+	}
+
+	return nil
+}
+
+// settle removes answered requests from the pending set.
+func (n *CapNegotiator) settle(names []string) {
+	for _, name := range names {
+		delete(n.pending, strings.TrimPrefix(name, string(capDisable)))
+	}
+}
+
+// wanted returns the wanted capabilities that are available, but not enabled
+// or requested yet.
+func (n *CapNegotiator) wanted() (names []string) {
+	for _, name := range n.want {
+		if n.Caps.Available(name) && !n.Caps.Enabled(name) && !n.pending[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// capParams extracts the subcommand and capability list from a CAP message:
+//
+//    CAP <target> <subcommand> [*] :<capabilities>
+//
+func capParams(m *Message) (subcommand string, more bool, caps []string) {
+
+	params := m.Params
+	if len(m.Trailing) > 0 || m.EmptyTrailing {
+		params = append(params[:len(params):len(params)], m.Trailing)
+	}
+
+	if len(params) < 2 {
+		return "", false, nil
+	}
+
+	subcommand = strings.ToUpper(params[1])
+
+	if len(params) > 2 {
+		more = len(params) > 3 && params[2] == capMore
+		caps = strings.Fields(params[len(params)-1])
+	}
+
+	return
+}
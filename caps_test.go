@@ -0,0 +1,102 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCapNegotiator(t *testing.T) {
+	n := NewCapNegotiator("multi-prefix", "sasl", "cap-notify", "away-notify", "missing")
+
+	if m := n.Start(); m.String() != "CAP LS 302" {
+		t.Fatalf("Wrong start message: %s", m.String())
+	}
+
+	if replies := n.Handle(ParseMessage(":irc.test CAP * LS * :multi-prefix sasl=PLAIN,EXTERNAL")); len(replies) > 0 || n.Done() {
+		t.Fatal("Negotiator should wait for the last LS line.")
+	}
+
+	replies := n.Handle(ParseMessage(":irc.test CAP * LS :cap-notify server-time"))
+	if len(replies) != 1 || replies[0].String() != "CAP REQ :multi-prefix sasl cap-notify" {
+		t.Fatalf("Wrong request: %v", replies)
+	}
+
+	if value, ok := n.Caps.Value("sasl"); !ok || value != "PLAIN,EXTERNAL" {
+		t.Errorf("Wrong capability value: %q", value)
+	}
+
+	if n.Done() {
+		t.Fatal("Negotiator should wait for ACK or NAK.")
+	}
+
+	n.Handle(ParseMessage(":irc.test CAP bot ACK :multi-prefix sasl cap-notify"))
+
+	if !n.Done() || !reflect.DeepEqual(n.Caps.List(), []string{"cap-notify", "multi-prefix", "sasl"}) {
+		t.Fatalf("Wrong capabilities enabled: %q", n.Caps.List())
+	}
+
+	var notified []string
+	n.Notify = func(subcommand string, names []string) {
+		notified = append(notified, subcommand+" "+strings.Join(names, ","))
+	}
+
+	replies = n.Handle(ParseMessage(":irc.test CAP bot NEW :away-notify extended-join"))
+	if len(replies) != 1 || replies[0].String() != "CAP REQ :away-notify" {
+		t.Fatalf("Wrong request: %v", replies)
+	}
+
+	n.Handle(ParseMessage(":irc.test CAP bot NAK :away-notify"))
+	n.Handle(ParseMessage(":irc.test CAP bot DEL :sasl"))
+
+	if n.Caps.Enabled("sasl") || n.Caps.Available("sasl") || n.Caps.Enabled("away-notify") {
+		t.Errorf("Wrong capabilities enabled: %q", n.Caps.List())
+	}
+
+	if !reflect.DeepEqual(notified, []string{"NEW away-notify,extended-join", "DEL sasl"}) {
+		t.Errorf("Wrong notifications: %q", notified)
+	}
+}
+
+func TestCapNegotiator_Request(t *testing.T) {
+	n := NewCapNegotiator()
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, "vendor.example/capability-"+strings.Repeat("x", i%10))
+	}
+
+	messages := n.Request(names...)
+
+	if len(messages) < 2 {
+		t.Fatalf("Long requests should be split, got %d messages", len(messages))
+	}
+
+	var requested []string
+	for _, m := range messages {
+		if m.Len()+relayPrefixLength > maxLength {
+			t.Errorf("Request is too long: %d", m.Len())
+		}
+		requested = append(requested, strings.Fields(m.Trailing)...)
+	}
+
+	if !reflect.DeepEqual(requested, names) {
+		t.Error("Requests should contain all capabilities in order.")
+	}
+}
+
+func TestCapNegotiator_List(t *testing.T) {
+	n := NewCapNegotiator()
+
+	n.Handle(ParseMessage(":irc.test CAP bot LIST * :a b"))
+	n.Handle(ParseMessage(":irc.test CAP bot LIST :c"))
+	n.Handle(ParseMessage(":irc.test CAP bot LIST :d"))
+
+	if !reflect.DeepEqual(n.Caps.List(), []string{"d"}) {
+		t.Errorf("Wrong capabilities enabled: %q", n.Caps.List())
+	}
+}
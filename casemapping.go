@@ -0,0 +1,219 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// CaseMapping defines which nicknames and channel names a server considers
+// equal. See the CASEMAPPING token of RPL_ISUPPORT.
+type CaseMapping interface {
+	// Name returns the name used in the CASEMAPPING token.
+	Name() string
+
+	// Fold returns the canonical, lowercase form of s.
+	Fold(s string) string
+
+	// Equal returns true if a and b are equal under this casemapping.
+	Equal(a, b string) bool
+}
+
+// Casemappings in use by IRC servers.
+var (
+	// Only the letters A to Z are mapped to a to z.
+	CaseMappingASCII CaseMapping = &byteMapping{"ascii", 'Z'}
+
+	// Like ascii, but also maps []\^ to {}|~, because of RFC1459's
+	// Scandinavian origin. This is the default.
+	CaseMappingRFC1459 CaseMapping = &byteMapping{"rfc1459", '^'}
+
+	// Like rfc1459, but does not map ^ to ~.
+	CaseMappingStrictRFC1459 CaseMapping = &byteMapping{"strict-rfc1459", ']'}
+
+	// Unicode casemapping based on the PRECIS framework.
+	//
+	// This implementation applies width mapping of fullwidth ASCII and Unicode
+	// lowercasing, but not Unicode normalization, as this package has no
+	// dependencies. Names that are already normalized compare correctly.
+	CaseMappingRFC7613 CaseMapping = &unicodeMapping{"rfc7613"}
+)
+
+// LookupCaseMapping returns the casemapping for a CASEMAPPING token value.
+// The ok value is false if the casemapping is unknown.
+func LookupCaseMapping(name string) (cm CaseMapping, ok bool) {
+	for _, cm := range []CaseMapping{CaseMappingASCII, CaseMappingRFC1459, CaseMappingStrictRFC1459, CaseMappingRFC7613} {
+		if strings.EqualFold(cm.Name(), name) {
+			return cm, true
+		}
+	}
+	return nil, false
+}
+
+// CaseMapper returns the casemapping advertised by the server, or rfc1459
+// if the server uses an unknown casemapping.
+func (s *ISupport) CaseMapper() CaseMapping {
+	if cm, ok := LookupCaseMapping(s.CaseMapping()); ok {
+		return cm
+	}
+	return CaseMappingRFC1459
+}
+
+// byteMapping maps A-Z to a-z, and optionally the characters following Z in
+// ASCII up to last to the characters following z.
+type byteMapping struct {
+	name string
+	last byte
+}
+
+func (b *byteMapping) Name() string {
+	return b.name
+}
+
+func (b *byteMapping) fold(c byte) byte {
+	if c >= 'A' && c <= b.last {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func (b *byteMapping) Fold(s string) string {
+	for i := 0; i < len(s); i++ {
+		if b.fold(s[i]) != s[i] {
+			f := []byte(s)
+			for j := i; j < len(f); j++ {
+				f[j] = b.fold(f[j])
+			}
+			return string(f)
+		}
+	}
+	return s
+}
+
+func (b *byteMapping) Equal(x, y string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := 0; i < len(x); i++ {
+		if b.fold(x[i]) != b.fold(y[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// unicodeMapping implements rfc7613 casemapping.
+type unicodeMapping struct {
+	name string
+}
+
+func (u *unicodeMapping) Name() string {
+	return u.name
+}
+
+func (u *unicodeMapping) Fold(s string) string {
+	return strings.ToLower(strings.Map(widthMap, s))
+}
+
+func (u *unicodeMapping) Equal(x, y string) bool {
+	return u.Fold(x) == u.Fold(y)
+}
+
+// widthMap maps fullwidth ASCII characters to their normal width equivalent.
+func widthMap(r rune) rune {
+	switch {
+	case r >= '！' && r <= '～':
+		return r - '！' + '!'
+	case r == '　':
+		return ' '
+	}
+	return r
+}
+
+// FoldMap is a map keyed by nicknames or channel names, comparing keys using
+// a casemapping. The original spelling of the most recently set key is kept.
+//
+// Like a normal map, a FoldMap is not safe for use by multiple goroutines.
+type FoldMap struct {
+	mapping CaseMapping
+	entries map[string]foldEntry
+}
+
+type foldEntry struct {
+	key   string
+	value interface{}
+}
+
+// NewFoldMap returns an empty FoldMap using cm to compare keys. If cm is
+// nil, rfc1459 casemapping is used.
+func NewFoldMap(cm CaseMapping) *FoldMap {
+	if cm == nil {
+		cm = CaseMappingRFC1459
+	}
+	return &FoldMap{
+		mapping: cm,
+		entries: make(map[string]foldEntry),
+	}
+}
+
+// Get returns the value for key. The ok value is false if key is not present.
+func (f *FoldMap) Get(key string) (value interface{}, ok bool) {
+	e, ok := f.entries[f.mapping.Fold(key)]
+	return e.value, ok
+}
+
+// Has returns true if key is present.
+func (f *FoldMap) Has(key string) bool {
+	_, ok := f.entries[f.mapping.Fold(key)]
+	return ok
+}
+
+// Set sets the value for key.
+func (f *FoldMap) Set(key string, value interface{}) {
+	f.entries[f.mapping.Fold(key)] = foldEntry{key, value}
+}
+
+// Delete removes key.
+func (f *FoldMap) Delete(key string) {
+	delete(f.entries, f.mapping.Fold(key))
+}
+
+// Rename moves the value for key old to key new, such as after a NICK
+// change. Returns false if old is not present.
+func (f *FoldMap) Rename(old, new string) bool {
+	e, ok := f.entries[f.mapping.Fold(old)]
+	if !ok {
+		return false
+	}
+	delete(f.entries, f.mapping.Fold(old))
+	f.entries[f.mapping.Fold(new)] = foldEntry{new, e.value}
+	return true
+}
+
+// Len returns the number of keys.
+func (f *FoldMap) Len() int {
+	return len(f.entries)
+}
+
+// Keys returns all keys in their original spelling, sorted.
+func (f *FoldMap) Keys() []string {
+	keys := make([]string, 0, len(f.entries))
+	for _, e := range f.entries {
+		keys = append(keys, e.key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Range calls fn for every key and value, in no particular order, until fn
+// returns false.
+func (f *FoldMap) Range(fn func(key string, value interface{}) bool) {
+	for _, e := range f.entries {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
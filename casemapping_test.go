@@ -0,0 +1,91 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+var caseMappingTests = [...]*struct {
+	mapping CaseMapping
+	a, b    string
+	equal   bool
+}{
+	{CaseMappingASCII, "Nick", "nICK", true},
+	{CaseMappingASCII, "Foo[]", "foo{}", false},
+	{CaseMappingRFC1459, "Foo[]\\^", "foo{}|~", true},
+	{CaseMappingRFC1459, "Foo", "Fooo", false},
+	{CaseMappingStrictRFC1459, "Foo[]\\", "foo{}|", true},
+	{CaseMappingStrictRFC1459, "Foo^", "foo~", false},
+	{CaseMappingRFC7613, "ÉCOLE", "école", true},
+	{CaseMappingRFC7613, "ＮＩＣＫ", "nick", true},
+	{CaseMappingRFC7613, "Foo[]", "foo{}", false},
+}
+
+func TestCaseMapping_Equal(t *testing.T) {
+	for i, test := range caseMappingTests {
+		if test.mapping.Equal(test.a, test.b) != test.equal {
+			t.Errorf("Wrong result comparing %q and %q using %s (%d)", test.a, test.b, test.mapping.Name(), i)
+		}
+		if (test.mapping.Fold(test.a) == test.mapping.Fold(test.b)) != test.equal {
+			t.Errorf("Wrong result folding %q and %q using %s (%d)", test.a, test.b, test.mapping.Name(), i)
+		}
+	}
+}
+
+func TestLookupCaseMapping(t *testing.T) {
+	if cm, ok := LookupCaseMapping("strict-rfc1459"); !ok || cm != CaseMappingStrictRFC1459 {
+		t.Error("Failed to look up strict-rfc1459.")
+	}
+	if _, ok := LookupCaseMapping("unknown"); ok {
+		t.Error("Unknown casemappings should not be found.")
+	}
+
+	s := NewISupport()
+	if s.CaseMapper() != CaseMappingRFC1459 {
+		t.Error("Default casemapping should be rfc1459.")
+	}
+	s.Add("CASEMAPPING=ascii")
+	if s.CaseMapper() != CaseMappingASCII {
+		t.Error("Casemapping should be selected by CASEMAPPING.")
+	}
+}
+
+func TestFoldMap(t *testing.T) {
+	f := NewFoldMap(nil)
+
+	f.Set("Foo[]", 1)
+	f.Set("Bar", 2)
+
+	if v, ok := f.Get("FOO{}"); !ok || v != 1 {
+		t.Error("Keys should be compared using the casemapping.")
+	}
+
+	f.Set("foo{}", 3)
+
+	if f.Len() != 2 || !reflect.DeepEqual(f.Keys(), []string{"Bar", "foo{}"}) {
+		t.Errorf("Wrong keys: %q", f.Keys())
+	}
+
+	if !f.Rename("BAR", "Baz") || f.Has("bar") || !f.Has("baz") {
+		t.Error("Failed to rename key.")
+	}
+	if f.Rename("missing", "other") {
+		t.Error("Renaming a missing key should fail.")
+	}
+
+	f.Delete("BAZ")
+
+	n := 0
+	f.Range(func(key string, value interface{}) bool {
+		n++
+		return true
+	})
+
+	if n != 1 {
+		t.Errorf("Range should visit 1 key, visited %d", n)
+	}
+}
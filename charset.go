@@ -0,0 +1,206 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"sync"
+	"unicode/utf8"
+)
+
+// Charset converts text between UTF-8 and a legacy character encoding.
+//
+// Encodings from golang.org/x/text can be used with a small adapter around
+// their NewDecoder().String and NewEncoder().String methods, this package
+// only includes some single byte encodings. Multibyte and stateful encodings
+// such as ISO-2022-JP are out of scope, use golang.org/x/text/encoding/japanese
+// for those.
+type Charset interface {
+	// ToUTF8 converts text in this encoding to UTF-8.
+	ToUTF8(s string) (string, error)
+
+	// FromUTF8 converts UTF-8 text to this encoding.
+	FromUTF8(s string) (string, error)
+}
+
+// Character used for runes that can't be represented in a single byte encoding.
+const charsetReplacement byte = '?'
+
+// Single byte encodings, mapping bytes 0x80 to 0xFF to Unicode.
+var (
+	// ISO-8859-1, maps every byte to the Unicode code point with the same value.
+	CharsetLatin1 Charset = NewSingleByteCharset(latin1)
+
+	// Windows-1251, for Cyrillic scripts.
+	CharsetCP1251 Charset = NewSingleByteCharset(cp1251)
+)
+
+var latin1 = func() (table [128]rune) {
+	for i := range table {
+		table[i] = rune(0x80 + i)
+	}
+	return table
+}()
+
+var cp1251 = func() (table [128]rune) {
+	copy(table[:], []rune{
+		0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021, 0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+		0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x0000, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+		0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7, 0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+		0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7, 0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+	})
+	// 0xC0 to 0xFF map to А to я.
+	for i := 0x40; i < 0x80; i++ {
+		table[i] = rune(0x0410 + i - 0x40)
+	}
+	return table
+}()
+
+// singleByte is a Charset using a table for bytes 0x80 to 0xFF.
+type singleByte struct {
+	table   [128]rune
+	reverse map[rune]byte
+	once    sync.Once
+}
+
+// NewSingleByteCharset returns a Charset for an ASCII compatible single byte
+// encoding. The table maps bytes 0x80 to 0xFF to Unicode, zero for bytes
+// that are not used.
+func NewSingleByteCharset(table [128]rune) Charset {
+	return &singleByte{table: table}
+}
+
+// ToUTF8 converts text in this encoding to UTF-8. Unused bytes are replaced
+// by U+FFFD.
+func (c *singleByte) ToUTF8(s string) (string, error) {
+	b := new(bytes.Buffer)
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		switch r := s[i]; {
+		case r < utf8.RuneSelf:
+			b.WriteByte(r)
+		case c.table[r-utf8.RuneSelf] != 0:
+			b.WriteRune(c.table[r-utf8.RuneSelf])
+		default:
+			b.WriteRune(utf8.RuneError)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// FromUTF8 converts UTF-8 text to this encoding. Runes that can't be
+// represented are replaced by '?'.
+func (c *singleByte) FromUTF8(s string) (string, error) {
+	c.once.Do(func() {
+		c.reverse = make(map[rune]byte, len(c.table))
+		for i, r := range c.table {
+			if r != 0 {
+				c.reverse[r] = byte(i) + utf8.RuneSelf
+			}
+		}
+	})
+
+	b := new(bytes.Buffer)
+	b.Grow(len(s))
+
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteByte(byte(r))
+		} else if v, ok := c.reverse[r]; ok {
+			b.WriteByte(v)
+		} else {
+			b.WriteByte(charsetReplacement)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// CharsetMap holds Charset overrides for channels and nicknames.
+//
+// Targets are compared using rfc1459 casemapping. CharsetMap is safe for
+// concurrent use.
+type CharsetMap struct {
+	targets *FoldMap
+	mu      sync.RWMutex
+}
+
+// NewCharsetMap returns an empty CharsetMap.
+func NewCharsetMap() *CharsetMap {
+	return &CharsetMap{
+		targets: NewFoldMap(nil),
+	}
+}
+
+// Get returns the Charset for target, or nil if there is no override.
+func (c *CharsetMap) Get(target string) Charset {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cs, ok := c.targets.Get(target); ok {
+		return cs.(Charset)
+	}
+	return nil
+}
+
+// Set uses cs for messages to or from target.
+func (c *CharsetMap) Set(target string, cs Charset) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets.Set(target, cs)
+}
+
+// Delete removes the override for target.
+func (c *CharsetMap) Delete(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets.Delete(target)
+}
+
+// lookup returns the override for the target of m, or for its sender.
+func (c *CharsetMap) lookup(m *Message) Charset {
+	if c == nil {
+		return nil
+	}
+	if len(m.Params) > 0 {
+		if cs := c.Get(m.Params[0]); cs != nil {
+			return cs
+		}
+	}
+	if m.Prefix != nil {
+		return c.Get(m.Prefix.Name)
+	}
+	return nil
+}
+
+// transcode returns a copy of m with its parameters converted by convert.
+// Parameters are only converted if force is set or they are not valid UTF-8.
+func transcode(m *Message, convert func(string) (string, error), force bool) (*Message, error) {
+	var err error
+
+	c := *m
+	c.Params = make([]string, len(m.Params))
+
+	for i, p := range m.Params {
+		if force || !utf8.ValidString(p) {
+			if p, err = convert(p); err != nil {
+				return nil, err
+			}
+		}
+		c.Params[i] = p
+	}
+
+	if force || !utf8.ValidString(m.Trailing) {
+		if c.Trailing, err = convert(m.Trailing); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var charsetTests = [...]*struct {
+	charset Charset
+	raw     string
+	text    string
+}{
+	{CharsetLatin1, "caf\xe9 cr\xe8me", "café crème"},
+	{CharsetCP1251, "\xcf\xf0\xe8\xe2\xe5\xf2, \xa8\xb8 \xb9 \x88", "Привет, Ёё № €"},
+	{CharsetCP1251, "plain ascii", "plain ascii"},
+}
+
+func TestCharset(t *testing.T) {
+	for i, test := range charsetTests {
+		if text, err := test.charset.ToUTF8(test.raw); err != nil || text != test.text {
+			t.Errorf("Failed to decode %d: %q %v", i, text, err)
+		}
+		if raw, err := test.charset.FromUTF8(test.text); err != nil || raw != test.raw {
+			t.Errorf("Failed to encode %d: %q %v", i, raw, err)
+		}
+	}
+
+	// Unmapped runes and bytes are replaced.
+	if raw, _ := CharsetLatin1.FromUTF8("日本"); raw != "??" {
+		t.Errorf("Unmapped runes should be replaced, got %q", raw)
+	}
+	if text, _ := CharsetCP1251.ToUTF8("\x98"); text != "�" {
+		t.Errorf("Unused bytes should be replaced, got %q", text)
+	}
+}
+
+func TestDecoder_Charset(t *testing.T) {
+	input := strings.Join([]string{
+		":a!a@host PRIVMSG #fr :caf\xe9",
+		":a!a@host PRIVMSG #fr :café",
+		":b!b@host PRIVMSG #ru :\xcf\xf0\xe8\xe2\xe5\xf2",
+		":b!b@host PRIVMSG bot :\xcf\xf0\xe8\xe2\xe5\xf2",
+		":b!b@host PRIVMSG #ru :Привет",
+		"",
+	}, "\r\n")
+
+	dec := NewDecoder(strings.NewReader(input))
+	dec.Charset = CharsetLatin1
+	dec.TargetCharsets = NewCharsetMap()
+	dec.TargetCharsets.Set("#RU", CharsetCP1251)
+	dec.TargetCharsets.Set("b", CharsetCP1251)
+
+	for i, expected := range []string{"café", "café", "Привет", "Привет", "Привет"} {
+		m, err := dec.Decode()
+		if err != nil || m.Trailing != expected {
+			t.Errorf("Message %d: expected %q, got %v %v", i, expected, m, err)
+		}
+	}
+}
+
+func TestEncoder_Charset(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	enc := NewEncoder(buffer)
+	enc.Charset = CharsetLatin1
+	enc.TargetCharsets = NewCharsetMap()
+	enc.TargetCharsets.Set("#ru", CharsetCP1251)
+
+	enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#fr"}, Trailing: "café"})
+	enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#ru"}, Trailing: "Привет"})
+
+	expected := "PRIVMSG #fr :caf\xe9\r\nPRIVMSG #ru :\xcf\xf0\xe8\xe2\xe5\xf2\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Wrong output: %q", buffer.String())
+	}
+}
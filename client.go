@@ -0,0 +1,578 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorcix/irc/sasl"
+)
+
+// Defaults used for ClientConfig settings that are not set.
+const (
+	clientMinBackoff = time.Second
+	clientMaxBackoff = 5 * time.Minute
+)
+
+// Various constants used for MONITOR commands.
+const (
+	monitorAdd    = "+"
+	monitorRemove = "-"
+	monitorClear  = "C"
+)
+
+// ErrNotConnected is returned by Client.Encode when the client is not
+// registered with a server.
+var ErrNotConnected = errors.New("irc: not connected")
+
+// ClientEventType identifies the kind of a ClientEvent.
+type ClientEventType int
+
+// Lifecycle events reported by a Client.
+const (
+	ClientConnecting   ClientEventType = iota // Dialing the server
+	ClientConnected                           // Registered and session restored
+	ClientDisconnected                        // Connection failed or was lost
+	ClientWaiting                             // Waiting before the next attempt
+)
+
+func (t ClientEventType) String() string {
+	switch t {
+	case ClientConnecting:
+		return "connecting"
+	case ClientConnected:
+		return "connected"
+	case ClientDisconnected:
+		return "disconnected"
+	case ClientWaiting:
+		return "waiting"
+	}
+	return "unknown"
+}
+
+// ClientEvent describes a change in the connection of a Client.
+type ClientEvent struct {
+	Type    ClientEventType
+	Addr    string        // Address being dialed
+	Attempt int           // Failed attempts since the last registration
+	Delay   time.Duration // Time until the next attempt, for ClientWaiting
+	Welcome *Welcome      // Registration details, for ClientConnected
+	Err     error         // Why the connection ended, for ClientDisconnected
+}
+
+// ClientConfig contains the settings for a Client.
+type ClientConfig struct {
+	Addr         string             // Server address, host:port
+	Dial         DialConfig         // TLS and STS settings
+	Registration RegistrationConfig // Negotiator is not used
+
+	// Creates the SASL mechanism for every attempt, overriding
+	// Registration.SASL. The built-in mechanisms are reset for every attempt,
+	// a factory is only needed for custom mechanisms that keep state without
+	// implementing sasl.Resetter.
+	NewSASL func() sasl.Mechanism
+
+	Keepalive   *KeepaliveConfig // Enables the keepalive, see Conn.StartKeepalive
+	RateLimiter *RateLimiter     // Shared by all connections
+
+	// Receives every message after registration, in order. May be nil.
+	Handler Handler
+
+	// Called for lifecycle events, from the goroutine calling Run. May be nil.
+	OnEvent func(ClientEvent)
+
+	// Delay before the first reconnect, doubled for every failed attempt up
+	// to MaxBackoff. Defaults to 1 second and 5 minutes.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Client keeps a connection to an IRC server, reconnecting when it is lost.
+//
+// After reconnecting, the client registers again and restores its session:
+// it rejoins channels (with keys), restores its away message and MONITOR
+// list. Channels are tracked from the server's JOIN, PART and KICK messages.
+// Keys, away messages and MONITOR changes are tracked from messages sent using
+// Client.Encode, so those should not be sent using a ReplyWriter.
+type Client struct {
+	config ClientConfig
+
+	conn     *Conn
+	nick     string
+	isupport *ISupport
+	channels *FoldMap // Channel name to key
+	keys     *FoldMap // Keys of channels we asked to join
+	monitor  *FoldMap
+	away     string
+	upgrade  string // Address to use after an STS upgrade
+	quit     bool
+	mu       sync.Mutex
+	quitMu   sync.Mutex // Held while sending QUIT, so Run sees the result
+}
+
+// NewClient returns a Client using config. Call Run to connect.
+func NewClient(config ClientConfig) *Client {
+	return &Client{
+		config:   config,
+		isupport: NewISupport(),
+		channels: NewFoldMap(nil),
+		keys:     NewFoldMap(nil),
+		monitor:  NewFoldMap(nil),
+	}
+}
+
+// Run connects to the server and handles messages until ctx is done, or the
+// client sent QUIT. Lost connections are redialed with exponential backoff.
+//
+// Run returns nil after QUIT, ctx.Err() when ctx is done, or the
+// *RegistrationError if the server refused the password or SASL credentials.
+func (c *Client) Run(ctx context.Context) error {
+	c.mu.Lock()
+	c.quit = false
+	c.mu.Unlock()
+
+	for attempt := 0; ; {
+		registered, err := c.connect(ctx, attempt)
+
+		c.emit(ClientEvent{Type: ClientDisconnected, Addr: c.addr(), Attempt: attempt, Err: err})
+
+		c.quitMu.Lock()
+		c.mu.Lock()
+		quit := c.quit
+		c.mu.Unlock()
+		c.quitMu.Unlock()
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case quit:
+			return nil
+		case fatal(err):
+			return err
+		}
+
+		if registered {
+			attempt = 0
+		}
+		if _, ok := err.(*STSUpgradeError); ok {
+			// Reconnect using TLS right away.
+			continue
+		}
+
+		delay := c.backoff(attempt)
+		attempt++
+
+		c.emit(ClientEvent{Type: ClientWaiting, Addr: c.addr(), Attempt: attempt, Delay: delay})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Encode sends m to the server. JOIN, AWAY and MONITOR messages are tracked
+// to restore the session after reconnecting. Run stops reconnecting once a
+// QUIT was sent successfully.
+//
+// Returns ErrNotConnected if the client is not registered.
+func (c *Client) Encode(m *Message) error {
+	quit := m.Command == QUIT
+	if quit {
+		c.quitMu.Lock()
+		defer c.quitMu.Unlock()
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.outgoing(m)
+	if conn != nil && quit {
+		// Set before sending, the server may close the connection before
+		// Encode returns.
+		c.quit = true
+	}
+	c.mu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	err := conn.Encode(m)
+	if err != nil && quit {
+		c.mu.Lock()
+		c.quit = false
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Join sends a JOIN for channel, using key if it isn't empty.
+func (c *Client) Join(channel, key string) error {
+	params := []string{channel}
+	if len(key) > 0 {
+		params = append(params, key)
+	}
+	return c.Encode(&Message{Command: JOIN, Params: params})
+}
+
+// Nick returns our current nickname, or an empty string if the client never
+// registered.
+func (c *Client) Nick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// Channels returns the channels the client is in, or will rejoin after
+// reconnecting, sorted.
+func (c *Client) Channels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.channels.Keys()
+}
+
+// addr returns the address for the next connection.
+func (c *Client) addr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.upgrade) > 0 {
+		return c.upgrade
+	}
+	return c.config.Addr
+}
+
+// emit reports an event to the application.
+func (c *Client) emit(e ClientEvent) {
+	if c.config.OnEvent != nil {
+		c.config.OnEvent(e)
+	}
+}
+
+// backoff returns the delay before the next attempt, with jitter so clients
+// don't reconnect all at once.
+func (c *Client) backoff(attempt int) time.Duration {
+	min, max := c.config.MinBackoff, c.config.MaxBackoff
+	if min <= 0 {
+		min = clientMinBackoff
+	}
+	if max <= 0 {
+		max = clientMaxBackoff
+	}
+
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay = delay * 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Use a random delay between half and the full delay.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// fatal returns true for errors that won't go away by reconnecting.
+func fatal(err error) bool {
+	if rerr, ok := err.(*RegistrationError); ok {
+		switch rerr.Err {
+		case ErrPasswordMismatch, ErrSASLFailed, ErrSASLUnavailable:
+			return true
+		}
+	}
+	return false
+}
+
+// connect runs a single connection, until it is lost.
+func (c *Client) connect(ctx context.Context, attempt int) (registered bool, err error) {
+	addr := c.addr()
+	dial := c.config.Dial
+	if addr != c.config.Addr && dial.TLSConfig == nil {
+		dial.TLSConfig = new(tls.Config)
+	}
+
+	c.emit(ClientEvent{Type: ClientConnecting, Addr: addr, Attempt: attempt})
+
+	conn, err := DialWithConfig(ctx, addr, &dial)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	conn.RateLimiter = c.config.RateLimiter
+	if c.config.Keepalive != nil {
+		conn.StartKeepalive(*c.config.Keepalive)
+	}
+
+	config := c.config.Registration
+	config.Negotiator = nil
+	if c.config.NewSASL != nil {
+		config.SASL = c.config.NewSASL()
+	}
+
+	w, err := conn.Register(ctx, config)
+	if serr, ok := err.(*STSUpgradeError); ok {
+		c.mu.Lock()
+		c.upgrade = serr.Addr
+		c.mu.Unlock()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.nick, c.isupport = w.Nick, w.ISupport
+	c.remap()
+	restore := c.restore()
+	c.mu.Unlock()
+
+	for _, m := range restore {
+		if err = conn.EncodeContext(ctx, m); err != nil {
+			return true, err
+		}
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	c.emit(ClientEvent{Type: ClientConnected, Addr: addr, Attempt: attempt, Welcome: w})
+
+	for {
+		m, err := conn.DecodeContext(ctx)
+
+		switch err.(type) {
+		case nil:
+		case *ParseError:
+			continue
+		default:
+			return true, err
+		}
+		if m == nil {
+			continue
+		}
+
+		c.mu.Lock()
+		c.incoming(m)
+		c.mu.Unlock()
+
+		if c.config.Handler != nil {
+			c.config.Handler.ServeIRC(NewReplyWriter(&conn.Encoder, m, c.isupport), m)
+		}
+	}
+}
+
+// restore returns the messages that restore the session. The caller holds
+// c.mu.
+func (c *Client) restore() (messages []*Message) {
+	limit := maxLength - relayPrefixLength
+
+	// Keyed channels go first, so keys line up with their channels.
+	var keyed, open []string
+	c.channels.Range(func(channel string, key interface{}) bool {
+		if len(key.(string)) > 0 {
+			keyed = append(keyed, channel)
+			c.keys.Set(channel, key)
+		} else {
+			open = append(open, channel)
+		}
+		return true
+	})
+
+	var channels, keys []string
+	length := len(JOIN) + 2
+	for _, channel := range append(keyed, open...) {
+		key, _ := c.keys.Get(channel)
+		l := len(channel) + len(key.(string)) + 2
+		if length+l > limit && len(channels) > 0 {
+			messages = append(messages, joinMessage(channels, keys))
+			channels, keys, length = nil, nil, len(JOIN)+2
+		}
+		channels = append(channels, channel)
+		if len(key.(string)) > 0 {
+			keys = append(keys, key.(string))
+		}
+		length = length + l
+	}
+	if len(channels) > 0 {
+		messages = append(messages, joinMessage(channels, keys))
+	}
+
+	if _, ok := c.isupport.Monitor(); ok && c.monitor.Len() > 0 {
+		var targets []string
+		length = len(MONITOR) + len(monitorAdd) + 2
+		for _, target := range c.monitor.Keys() {
+			if length+len(target)+1 > limit && len(targets) > 0 {
+				messages = append(messages, &Message{Command: MONITOR, Params: []string{monitorAdd, strings.Join(targets, ",")}})
+				targets, length = nil, len(MONITOR)+len(monitorAdd)+2
+			}
+			targets = append(targets, target)
+			length = length + len(target) + 1
+		}
+		messages = append(messages, &Message{Command: MONITOR, Params: []string{monitorAdd, strings.Join(targets, ",")}})
+	}
+
+	if len(c.away) > 0 {
+		messages = append(messages, &Message{Command: AWAY, Trailing: c.away})
+	}
+
+	return messages
+}
+
+// joinMessage returns a JOIN for channels, with optional keys.
+func joinMessage(channels, keys []string) *Message {
+	params := []string{strings.Join(channels, ",")}
+	if len(keys) > 0 {
+		params = append(params, strings.Join(keys, ","))
+	}
+	return &Message{Command: JOIN, Params: params}
+}
+
+// outgoing tracks messages sent by the application. The caller holds c.mu.
+func (c *Client) outgoing(m *Message) {
+	params := messageParams(m)
+
+	switch m.Command {
+
+	case JOIN:
+		if len(params) <= 0 {
+			break
+		}
+		var keys []string
+		if len(params) > 1 {
+			keys = strings.Split(params[1], ",")
+		}
+		for i, channel := range strings.Split(params[0], ",") {
+			if i < len(keys) {
+				c.keys.Set(channel, keys[i])
+			} else {
+				c.keys.Delete(channel)
+			}
+		}
+
+	case AWAY:
+		c.away = ""
+		if len(params) > 0 {
+			c.away = params[0]
+		}
+
+	case MONITOR:
+		if len(params) <= 0 {
+			break
+		}
+		var targets []string
+		if len(params) > 1 {
+			targets = strings.Split(params[1], ",")
+		}
+		switch params[0] {
+		case monitorAdd:
+			for _, target := range targets {
+				c.monitor.Set(target, nil)
+			}
+		case monitorRemove:
+			for _, target := range targets {
+				c.monitor.Delete(target)
+			}
+		case monitorClear:
+			c.monitor = NewFoldMap(c.isupport.CaseMapper())
+		}
+	}
+}
+
+// remap rebuilds the channel, key and MONITOR sets using the casemapping of
+// the server. The caller holds c.mu.
+func (c *Client) remap() {
+	mapping := c.isupport.CaseMapper()
+	c.channels = refold(c.channels, mapping)
+	c.keys = refold(c.keys, mapping)
+	c.monitor = refold(c.monitor, mapping)
+}
+
+// refold returns a copy of f using mapping.
+func refold(f *FoldMap, mapping CaseMapping) *FoldMap {
+	r := NewFoldMap(mapping)
+	f.Range(func(key string, value interface{}) bool {
+		r.Set(key, value)
+		return true
+	})
+	return r
+}
+
+// incoming tracks messages received from the server. The caller holds c.mu.
+func (c *Client) incoming(m *Message) {
+	params := messageParams(m)
+	mapping := c.isupport.CaseMapper()
+	self := m.Prefix != nil && mapping.Equal(m.Prefix.Name, c.nick)
+
+	switch {
+
+	case m.Command == NICK && self && len(params) > 0:
+		c.nick = params[0]
+
+	case m.Command == JOIN && self && len(params) > 0:
+		key, ok := c.keys.Get(params[0])
+		if !ok {
+			key = ""
+		}
+		c.channels.Set(params[0], key)
+
+	case m.Command == PART && self && len(params) > 0:
+		for _, channel := range strings.Split(params[0], ",") {
+			c.channels.Delete(channel)
+			c.keys.Delete(channel)
+		}
+
+	case m.Command == KICK && len(params) > 1 && mapping.Equal(params[1], c.nick):
+		c.channels.Delete(params[0])
+
+	case m.Command == MODE && len(params) > 1 && c.channels.Has(params[0]):
+		c.channelKey(params[0], params[1:])
+
+	case m.Command == RPL_CHANNELMODEIS && len(params) > 2 && c.channels.Has(params[1]):
+		c.channelKey(params[1], params[2:])
+
+	case m.Command == RPL_UNAWAY:
+		c.away = ""
+	}
+}
+
+// channelKey updates the key of a channel from a mode change.
+func (c *Client) channelKey(channel string, params []string) {
+	changes, _ := ParseModeChange(params, c.isupport.ChanModes())
+	for _, change := range changes {
+		if change.Mode != 'k' {
+			continue
+		}
+		if !change.Add {
+			c.channels.Set(channel, "")
+			c.keys.Delete(channel)
+		} else if len(change.Param) > 0 && change.Param != "*" {
+			c.channels.Set(channel, change.Param)
+			c.keys.Set(channel, change.Param)
+		}
+	}
+}
+
+// messageParams returns the parameters of m, including the trailing one.
+func messageParams(m *Message) []string {
+	if len(m.Trailing) > 0 || m.EmptyTrailing {
+		return append(m.Params[:len(m.Params):len(m.Params)], m.Trailing)
+	}
+	return m.Params
+}
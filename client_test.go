@@ -0,0 +1,290 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc/sasl"
+)
+
+// testListener accepts connections until the test ends, calling handler for
+// every message received on the n-th connection. Returning false from
+// handler closes that connection.
+func testListener(t *testing.T, handler func(n int, m *Message, enc *Encoder) bool) (addr string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	go func() {
+		for n := 0; ; n++ {
+			server, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(n int, server net.Conn) {
+				defer server.Close()
+				dec, enc := NewDecoder(server), NewEncoder(server)
+				for {
+					m, err := dec.Decode()
+					if err != nil || !handler(n, m, enc) {
+						return
+					}
+				}
+			}(n, server)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestClient_Run(t *testing.T) {
+	var (
+		received [2][]string
+		mu       sync.Mutex
+	)
+
+	addr, stop := testListener(t, func(n int, m *Message, enc *Encoder) bool {
+		mu.Lock()
+		received[n%2] = append(received[n%2], m.String())
+		mu.Unlock()
+
+		switch {
+		case m.Command == CAP && m.Params[0] == CAP_LS:
+			send(enc, ":irc.test CAP * LS :sasl=PLAIN")
+		case m.Command == CAP && m.Params[0] == CAP_REQ:
+			send(enc, ":irc.test CAP * ACK :"+m.Trailing)
+		case m.Command == AUTHENTICATE && m.Params[0] == "PLAIN":
+			send(enc, "AUTHENTICATE +")
+		case m.Command == AUTHENTICATE:
+			send(enc, ":irc.test 903 bot :SASL authentication successful")
+		case m.Command == CAP && m.Params[0] == CAP_END:
+			send(enc,
+				":irc.test 001 bot :Welcome",
+				":irc.test 005 bot MONITOR=100 :are supported by this server",
+				":irc.test 422 bot :MOTD File is missing",
+			)
+		case m.Command == JOIN:
+			send(enc, ":bot!bot@host JOIN #secret")
+		case m.Command == MONITOR:
+			// Drop the first connection when the session is set up.
+			return n > 0
+		}
+		return true
+	})
+	defer stop()
+
+	events := make(chan ClientEvent, 10)
+	// Both connections authenticate using the same mechanism.
+	c := NewClient(ClientConfig{
+		Addr:         addr,
+		Registration: RegistrationConfig{Nick: "bot", SASL: sasl.NewPlain("", "account", "password")},
+		MinBackoff:   time.Millisecond,
+		OnEvent: func(e ClientEvent) {
+			events <- e
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- c.Run(ctx)
+	}()
+
+	next := func(expected ClientEventType) ClientEvent {
+		select {
+		case e := <-events:
+			if e.Type != expected {
+				t.Fatalf("Expected %s event, got %s: %v", expected, e.Type, e.Err)
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for %s event", expected)
+		}
+		return ClientEvent{}
+	}
+
+	next(ClientConnecting)
+	if e := next(ClientConnected); e.Welcome.Nick != "bot" {
+		t.Errorf("Wrong welcome: %#v", e.Welcome)
+	}
+
+	c.Join("#secret", "key")
+	c.Encode(&Message{Command: AWAY, Trailing: "brb"})
+	c.Encode(&Message{Command: MONITOR, Params: []string{"+", "alice,bob"}})
+
+	next(ClientDisconnected)
+	if e := next(ClientWaiting); e.Delay > time.Millisecond {
+		t.Errorf("Backoff delay too long: %s", e.Delay)
+	}
+	next(ClientConnecting)
+	next(ClientConnected)
+
+	if channels := c.Channels(); !reflect.DeepEqual(channels, []string{"#secret"}) {
+		t.Errorf("Wrong channels: %q", channels)
+	}
+
+	// Wait until the server saw the restored session.
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(received[1])
+		mu.Unlock()
+		if n >= 10 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expected := []string{
+		"CAP LS 302",
+		"NICK bot",
+		"USER bot 0 * :bot",
+		"CAP REQ :sasl",
+		"AUTHENTICATE PLAIN",
+		"AUTHENTICATE AGFjY291bnQAcGFzc3dvcmQ=",
+		"CAP END",
+		"JOIN #secret key",
+		"MONITOR + alice,bob",
+		"AWAY :brb",
+	}
+
+	if !reflect.DeepEqual(received[1], expected) {
+		t.Errorf("Session was not restored: %q", received[1])
+	}
+}
+
+func TestClient_Run_quit(t *testing.T) {
+	addr, stop := testListener(t, func(n int, m *Message, enc *Encoder) bool {
+		switch m.Command {
+		case USER:
+			send(enc, ":irc.test 001 bot :Welcome", ":irc.test 422 bot :MOTD File is missing")
+		case QUIT:
+			send(enc, "ERROR :Closing link")
+			return false
+		}
+		return true
+	})
+	defer stop()
+
+	var c *Client
+	c = NewClient(ClientConfig{
+		Addr:         addr,
+		Registration: RegistrationConfig{Nick: "bot"},
+		OnEvent: func(e ClientEvent) {
+			if e.Type == ClientConnected {
+				c.Encode(&Message{Command: QUIT})
+			}
+		},
+	})
+
+	if err := c.Encode(&Message{Command: PING, Trailing: "x"}); err != ErrNotConnected {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+
+	// A QUIT that wasn't sent doesn't stop the client.
+	if err := c.Encode(&Message{Command: QUIT}); err != ErrNotConnected || c.quit {
+		t.Errorf("Expected ErrNotConnected without quitting, got %v", err)
+	}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestClient_caseMapping(t *testing.T) {
+	addr, stop := testListener(t, func(n int, m *Message, enc *Encoder) bool {
+		switch m.Command {
+		case USER:
+			send(enc,
+				":irc.test 001 bot :Welcome",
+				":irc.test 005 bot CASEMAPPING=ascii :are supported by this server",
+				":irc.test 422 bot :MOTD File is missing",
+			)
+		case JOIN:
+			send(enc, ":bot!bot@host JOIN "+m.Params[0])
+		case MONITOR:
+			send(enc, "ERROR :Closing link")
+			return false
+		}
+		return true
+	})
+	defer stop()
+
+	var c *Client
+	c = NewClient(ClientConfig{
+		Addr:         addr,
+		Registration: RegistrationConfig{Nick: "bot"},
+		OnEvent: func(e ClientEvent) {
+			if e.Type == ClientConnected {
+				c.Join("#a[", "")
+				c.Join("#a{", "")
+				c.Encode(&Message{Command: MONITOR, Params: []string{"+", "x[,x{"}})
+			}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// Wait until the connection is closed after MONITOR.
+	for i := 0; i < 100; i++ {
+		if c.Encode(&Message{Command: PING, Trailing: "x"}) == ErrNotConnected && len(c.Channels()) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	if channels := c.Channels(); !reflect.DeepEqual(channels, []string{"#a[", "#a{"}) {
+		t.Errorf("Channels should be distinct with ascii casemapping: %q", channels)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.monitor.Len() != 2 {
+		t.Errorf("MONITOR targets should be distinct: %q", c.monitor.Keys())
+	}
+}
+
+func TestClient_Run_fatal(t *testing.T) {
+	addr, stop := testListener(t, func(n int, m *Message, enc *Encoder) bool {
+		if m.Command == USER {
+			send(enc, ":irc.test 464 * :Password incorrect")
+		}
+		return true
+	})
+	defer stop()
+
+	c := NewClient(ClientConfig{Addr: addr, Registration: RegistrationConfig{Nick: "bot"}})
+
+	if rerr, ok := c.Run(context.Background()).(*RegistrationError); !ok || rerr.Err != ErrPasswordMismatch {
+		t.Errorf("Expected ErrPasswordMismatch, got %v", rerr)
+	}
+}
+
+func TestClient_backoff(t *testing.T) {
+	c := NewClient(ClientConfig{MinBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := c.backoff(attempt); delay < max/2 || delay > max {
+			t.Errorf("Attempt %d: delay %s not between %s and %s", attempt, delay, max/2, max)
+		}
+	}
+}
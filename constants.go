@@ -244,8 +244,12 @@ const (
 	CAP_NAK   = "NAK"   // Subcommand (param)
 	CAP_CLEAR = "CLEAR" // Subcommand (param)
 	CAP_END   = "END"   // Subcommand (param)
+	CAP_NEW   = "NEW"   // Subcommand (param), cap-notify
+	CAP_DEL   = "DEL"   // Subcommand (param), cap-notify
 
 	AUTHENTICATE = "AUTHENTICATE"
+
+	MONITOR = "MONITOR"
 )
 
 // Numeric IRC replies extracted from the IRCv3 spec.
@@ -259,6 +263,12 @@ const (
 	ERR_SASLABORTED = "906"
 	ERR_SASLALREADY = "907"
 	RPL_SASLMECHS   = "908"
+
+	RPL_MONONLINE    = "730"
+	RPL_MONOFFLINE   = "731"
+	RPL_MONLIST      = "732"
+	RPL_ENDOFMONLIST = "733"
+	ERR_MONLISTFULL  = "734"
 )
 
 // RFC2812, section 5.3
@@ -5,6 +5,7 @@
 package ctcp
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -97,3 +98,115 @@ func TestTime(t *testing.T) {
 		t.Error("Wrong result!")
 	}
 }
+
+// Examples based on the quoting section of the CTCP specification.
+var quoteTests = [...]*struct {
+	data, low, ctcp string
+}{
+	{"Hi there!\nHow are you? \\K?", "Hi there!\x10nHow are you? \\K?", "Hi there!\nHow are you? \\\\K?"},
+	{"\x00\r\n\x10", "\x100\x10r\x10n\x10\x10", "\x00\r\n\x10"},
+	{"\x01SED\x01", "\x01SED\x01", "\\aSED\\a"},
+	{"plain text", "plain text", "plain text"},
+}
+
+func TestQuote(t *testing.T) {
+	for i, test := range quoteTests {
+		if low := LowQuote(test.data); low != test.low {
+			t.Errorf("LowQuote %d: %q", i, low)
+		}
+		if data := LowUnquote(test.low); data != test.data {
+			t.Errorf("LowUnquote %d: %q", i, data)
+		}
+		if ctcp := XQuote(test.data); ctcp != test.ctcp {
+			t.Errorf("XQuote %d: %q", i, ctcp)
+		}
+		if data := XUnquote(test.ctcp); data != test.data {
+			t.Errorf("XUnquote %d: %q", i, data)
+		}
+		if data := Unquote(Quote(test.data)); data != test.data {
+			t.Errorf("Quote %d does not round-trip: %q", i, data)
+		}
+	}
+
+	// Unknown sequences drop the quote character.
+	if data := LowUnquote("a\x10bc\x10"); data != "abc" {
+		t.Errorf("LowUnquote should drop unknown quotes, got %q", data)
+	}
+	if data := XUnquote("a\\bc\\"); data != "abc" {
+		t.Errorf("XUnquote should drop unknown quotes, got %q", data)
+	}
+}
+
+func TestEncodeQuoted(t *testing.T) {
+	text := EncodeQuoted("DCC", "SEND C:\\file\x01name.txt 3232235777 1024 2048\n")
+
+	if text != "\x01DCC SEND C:\\\\file\\aname.txt 3232235777 1024 2048\x10n\x01" {
+		t.Errorf("Wrong quoted text: %q", text)
+	}
+
+	tag, message, ok := DecodeQuoted(text)
+	if tag != "DCC" || message != "SEND C:\\file\x01name.txt 3232235777 1024 2048\n" || !ok {
+		t.Errorf("Failed to decode quoted text: %q %q %v", tag, message, ok)
+	}
+
+	if text := EncodeQuoted("", "INVALID"); len(text) > 0 {
+		t.Error("Message is invalid, but returns a non-empty string.")
+	}
+}
+
+var splitTests = [...]*struct {
+	text     string
+	segments []Segment
+	joined   string
+}{
+	{
+		text: "hello \x01ACTION waves\x01 bye",
+		segments: []Segment{
+			{Message: "hello "},
+			{Tag: ACTION, Message: "waves"},
+			{Message: " bye"},
+		},
+	},
+	{
+		text: "\x01PING 123\x01\x01VERSION\x01",
+		segments: []Segment{
+			{Tag: PING, Message: "123"},
+			{Tag: VERSION},
+		},
+	},
+	{
+		text:     "\x01ACTION waves",
+		segments: []Segment{{Tag: ACTION, Message: "waves"}},
+		joined:   "\x01ACTION waves\x01",
+	},
+	{
+		text:     "a\x01\x01b\x01 \x01",
+		segments: []Segment{{Message: "a"}, {Message: "b"}},
+		joined:   "ab",
+	},
+	{
+		text:     "just text",
+		segments: []Segment{{Message: "just text"}},
+	},
+	{
+		text: "",
+	},
+}
+
+func TestSplit(t *testing.T) {
+	for i, test := range splitTests {
+		segments := Split(test.text)
+
+		if !reflect.DeepEqual(segments, test.segments) {
+			t.Errorf("Failed to split %d: %q", i, segments)
+		}
+
+		joined := test.joined
+		if len(joined) <= 0 {
+			joined = test.text
+		}
+		if text := Join(segments); text != joined {
+			t.Errorf("Failed to join %d: %q", i, text)
+		}
+	}
+}
@@ -11,7 +11,11 @@
 //
 // Most IRC clients support only a subset of the protocol, and only a few
 // commands are actually used. This package aims to implement the most basic
-// CTCP messages: a single command per IRC message. Quoting is not supported.
+// CTCP messages: a single command per IRC message.
+//
+// Decode and Encode don't quote data. Use DecodeQuoted and EncodeQuoted for
+// data that may contain NUL, CR, LF or the CTCP delimiter, or Quote and
+// Unquote to apply the quoting layers yourself.
 //
 // Example using the irc.Message type:
 //
@@ -27,5 +31,12 @@
 //
 //    m.Trailing = ctcp.Encode("ACTION","wants a cookie!")
 //
+// Decode only accepts text consisting of a single tagged message. Use Split
+// for text mixing plain text and tagged data, and Join to build such text.
+//
+// Responder answers common requests such as VERSION and PING automatically:
+//
+//    mux.Handle(irc.PRIVMSG, ctcp.NewResponder())
+//
 // Do not send a complete IRC message to Decode, it won't work.
 package ctcp
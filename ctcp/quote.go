@@ -0,0 +1,137 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package ctcp
+
+import (
+	"strings"
+)
+
+// Quote characters from the CTCP spec.
+const (
+	lowQuote  byte = 0x10 // M-QUOTE, low level quoting
+	ctcpQuote byte = 0x5C // X-QUOTE, CTCP level quoting (\)
+)
+
+var lowQuoter = strings.NewReplacer(
+	"\x10", "\x10\x10",
+	"\x00", "\x100",
+	"\n", "\x10n",
+	"\r", "\x10r",
+)
+
+var ctcpQuoter = strings.NewReplacer(
+	"\\", "\\\\",
+	"\x01", "\\a",
+)
+
+// LowQuote applies low level quoting to message text, so it can contain NUL,
+// CR and LF characters.
+//
+//    NUL     --> M-QUOTE '0'
+//    NL      --> M-QUOTE 'n'
+//    CR      --> M-QUOTE 'r'
+//    M-QUOTE --> M-QUOTE M-QUOTE
+//
+// M-QUOTE is the character 0x10.
+func LowQuote(text string) string {
+	return lowQuoter.Replace(text)
+}
+
+// LowUnquote reverses LowQuote.
+//
+// The M-QUOTE before any other character is dropped, a trailing M-QUOTE
+// is ignored.
+func LowUnquote(text string) string {
+	return unquote(text, lowQuote, func(c byte) byte {
+		switch c {
+		case '0':
+			return 0
+		case 'n':
+			return '\n'
+		case 'r':
+			return '\r'
+		}
+		return c
+	})
+}
+
+// XQuote applies CTCP level quoting to extended data, so it can contain
+// the CTCP delimiter.
+//
+//    X-DELIM --> X-QUOTE 'a'
+//    X-QUOTE --> X-QUOTE X-QUOTE
+//
+// X-DELIM is the character 0x01, X-QUOTE is a backslash.
+func XQuote(data string) string {
+	return ctcpQuoter.Replace(data)
+}
+
+// XUnquote reverses XQuote.
+//
+// The X-QUOTE before any other character is dropped, a trailing X-QUOTE
+// is ignored.
+func XUnquote(data string) string {
+	return unquote(data, ctcpQuote, func(c byte) byte {
+		if c == 'a' {
+			return delimiter
+		}
+		return c
+	})
+}
+
+// Quote applies both quoting layers to extended data: CTCP level quoting
+// first, then low level quoting.
+func Quote(data string) string {
+	return LowQuote(XQuote(data))
+}
+
+// Unquote reverses Quote.
+func Unquote(data string) string {
+	return XUnquote(LowUnquote(data))
+}
+
+// DecodeQuoted is like Decode, but removes both quoting layers. Use it for
+// messages from clients that quote CTCP data.
+func DecodeQuoted(text string) (tag, message string, ok bool) {
+	if tag, message, ok = Decode(LowUnquote(text)); ok {
+		tag, message = XUnquote(tag), XUnquote(message)
+	}
+	return
+}
+
+// EncodeQuoted is like Encode, but quotes the tag and message so they may
+// contain any character, including NUL, CR, LF and the CTCP delimiter.
+func EncodeQuoted(tag, message string) (text string) {
+	if len(tag) <= 0 {
+		return empty
+	}
+	return LowQuote(Encode(XQuote(tag), XQuote(message)))
+}
+
+// unquote removes quote characters, replacing the character following each
+// quote using fn.
+func unquote(s string, quote byte, fn func(byte) byte) string {
+
+	// Fast path, nothing to unquote.
+	if strings.IndexByte(s, quote) < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != quote {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i >= len(s) {
+			break
+		}
+		b.WriteByte(fn(s[i]))
+	}
+
+	return b.String()
+}
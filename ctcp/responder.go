@@ -0,0 +1,186 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package ctcp
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorcix/irc"
+)
+
+// Minimum time between replies to the same sender, unless configured.
+const responderInterval = 2 * time.Second
+
+// HandlerFunc returns the reply to a CTCP request. The message is the text
+// following the tag. No reply is sent if ok is false.
+type HandlerFunc func(m *irc.Message, message string) (reply string, ok bool)
+
+// Responder replies to CTCP requests in PRIVMSG messages.
+//
+// Replies are sent to the sender using a NOTICE. To avoid being used to flood
+// others, a sender gets at most one reply every Interval; requests arriving
+// sooner are ignored.
+//
+// NewResponder registers handlers for VERSION, PING, TIME, CLIENTINFO, SOURCE
+// and USERINFO. Responder implements irc.Handler, so it can be registered
+// with an irc.ServeMux for PRIVMSG.
+type Responder struct {
+	Version  string        // VERSION reply, Go version info if empty
+	Source   string        // SOURCE reply, not answered if empty
+	UserInfo string        // USERINFO reply, not answered if empty
+	Interval time.Duration // Time between replies to a sender, 2 seconds if zero
+
+	handlers map[string]HandlerFunc
+	last     map[string]time.Time
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewResponder returns a Responder with the built-in handlers.
+func NewResponder() *Responder {
+	r := &Responder{
+		handlers: make(map[string]HandlerFunc),
+		last:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+
+	r.Handle(VERSION, func(m *irc.Message, message string) (string, bool) {
+		if len(r.Version) > 0 {
+			return r.Version, true
+		}
+		return fmt.Sprintf(versionFormat, runtime.Version()), true
+	})
+	r.Handle(PING, func(m *irc.Message, message string) (string, bool) {
+		return message, true
+	})
+	r.Handle(TIME, func(m *irc.Message, message string) (string, bool) {
+		return r.now().Format(timeFormat), true
+	})
+	r.Handle(CLIENTINFO, func(m *irc.Message, message string) (string, bool) {
+		return strings.Join(r.Tags(), string(space)), true
+	})
+	r.Handle(SOURCE, func(m *irc.Message, message string) (string, bool) {
+		return r.Source, len(r.Source) > 0
+	})
+	r.Handle(USERINFO, func(m *irc.Message, message string) (string, bool) {
+		return r.UserInfo, len(r.UserInfo) > 0
+	})
+
+	return r
+}
+
+// Handle registers fn for requests with given tag, replacing the previous
+// handler. A nil fn removes the handler.
+func (r *Responder) Handle(tag string, fn HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tag = strings.ToUpper(tag)
+	if fn == nil {
+		delete(r.handlers, tag)
+	} else {
+		r.handlers[tag] = fn
+	}
+}
+
+// Tags returns the tags with a registered handler, sorted.
+func (r *Responder) Tags() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := make([]string, 0, len(r.handlers))
+	for tag := range r.handlers {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Respond answers the CTCP requests in m using enc. Messages other than
+// PRIVMSG are ignored. Senders are compared using rfc1459 casemapping, use
+// ServeIRC to use the casemapping of the server.
+//
+// Returns the number of replies sent, and the first error from enc.
+func (r *Responder) Respond(enc *irc.Encoder, m *irc.Message) (replies int, err error) {
+	return r.respond(enc, m, irc.CaseMappingRFC1459)
+}
+
+// ServeIRC implements irc.Handler.
+func (r *Responder) ServeIRC(w *irc.ReplyWriter, m *irc.Message) {
+	r.respond(w.Encoder, m, w.ISupport().CaseMapper())
+}
+
+// respond implements Respond, comparing senders using mapping.
+func (r *Responder) respond(enc *irc.Encoder, m *irc.Message, mapping irc.CaseMapping) (replies int, err error) {
+
+	if m.Command != irc.PRIVMSG || m.Prefix == nil || len(m.Prefix.Name) <= 0 {
+		return 0, nil
+	}
+
+	for _, s := range Split(m.Trailing) {
+		if !s.IsTagged() {
+			continue
+		}
+
+		r.mu.Lock()
+		fn := r.handlers[strings.ToUpper(s.Tag)]
+		r.mu.Unlock()
+
+		// Handlers don't run at all for rate limited senders.
+		if fn == nil || !r.allow(mapping.Fold(m.Prefix.Name)) {
+			continue
+		}
+
+		reply, ok := fn(m, s.Message)
+		if !ok {
+			continue
+		}
+
+		err = enc.Encode(&irc.Message{
+			Command:  irc.NOTICE,
+			Params:   []string{m.Prefix.Name},
+			Trailing: Encode(strings.ToUpper(s.Tag), reply),
+		})
+		if err != nil {
+			return
+		}
+		replies++
+	}
+
+	return
+}
+
+// allow returns true if sender may get a reply now, and records the reply.
+// The sender is folded by the caller.
+func (r *Responder) allow(key string) bool {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = responderInterval
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+
+	if last, ok := r.last[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+
+	// Forget senders that may get a reply again, so the map doesn't grow.
+	for k, last := range r.last {
+		if now.Sub(last) >= interval {
+			delete(r.last, k)
+		}
+	}
+
+	r.last[key] = now
+	return true
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package ctcp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc"
+)
+
+func TestResponder(t *testing.T) {
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	r := NewResponder()
+	r.Version = "bot 1.0"
+	r.UserInfo = "A friendly bot"
+	r.now = func() time.Time { return now }
+	r.Handle("FINGER", func(m *irc.Message, message string) (string, bool) {
+		return "no fingers on " + m.Params[0], true
+	})
+
+	buffer := new(bytes.Buffer)
+	enc := irc.NewEncoder(buffer)
+
+	requests := []string{
+		":a!a@host PRIVMSG bot :\x01VERSION\x01",
+		":b!b@host PRIVMSG #go :\x01PING 12345\x01",
+		":c!c@host PRIVMSG bot :\x01TIME\x01",
+		":d!d@host PRIVMSG bot :\x01CLIENTINFO\x01",
+		":e!e@host PRIVMSG bot :\x01SOURCE\x01",
+		":f!f@host PRIVMSG bot :\x01USERINFO\x01",
+		":g!g@host PRIVMSG #go :hi \x01finger\x01",
+		":h!h@host PRIVMSG bot :\x01ACTION waves\x01",
+		":i!i@host NOTICE bot :\x01VERSION\x01",
+	}
+
+	for _, raw := range requests {
+		if _, err := r.Respond(enc, irc.ParseMessage(raw)); err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+	}
+
+	expected := strings.Join([]string{
+		"NOTICE a :\x01VERSION bot 1.0\x01",
+		"NOTICE b :\x01PING 12345\x01",
+		"NOTICE c :\x01TIME Thu, 02 Jan 2014 03:04:05 +0000\x01",
+		"NOTICE d :\x01CLIENTINFO CLIENTINFO FINGER PING SOURCE TIME USERINFO VERSION\x01",
+		"NOTICE f :\x01USERINFO A friendly bot\x01",
+		"NOTICE g :\x01FINGER no fingers on #go\x01",
+		"",
+	}, "\r\n")
+
+	if buffer.String() != expected {
+		t.Errorf("Wrong replies: %q", buffer.String())
+	}
+}
+
+func TestResponder_rateLimit(t *testing.T) {
+	now := time.Now()
+
+	r := NewResponder()
+	r.Interval = time.Minute
+	r.now = func() time.Time { return now }
+
+	enc := irc.NewEncoder(new(bytes.Buffer))
+	flood := irc.ParseMessage(":a!a@host PRIVMSG bot :\x01PING 1\x01\x01PING 2\x01\x01VERSION\x01")
+
+	if replies, _ := r.Respond(enc, flood); replies != 1 {
+		t.Errorf("Expected 1 reply, got %d", replies)
+	}
+	if replies, _ := r.Respond(enc, irc.ParseMessage(":A!a@host PRIVMSG bot :\x01PING 3\x01")); replies != 0 {
+		t.Errorf("Sender should be rate limited, got %d replies", replies)
+	}
+	if replies, _ := r.Respond(enc, irc.ParseMessage(":b!b@host PRIVMSG bot :\x01PING 3\x01")); replies != 1 {
+		t.Errorf("Other senders should not be rate limited, got %d replies", replies)
+	}
+
+	now = now.Add(time.Minute)
+
+	if replies, _ := r.Respond(enc, irc.ParseMessage(":a!a@host PRIVMSG bot :\x01PING 4\x01")); replies != 1 {
+		t.Errorf("Sender should get a reply after the interval, got %d replies", replies)
+	}
+	if len(r.last) != 1 {
+		t.Errorf("Old senders should be forgotten: %v", r.last)
+	}
+}
+
+func TestResponder_ServeIRC(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	m := irc.ParseMessage(":a!a@host PRIVMSG bot :\x01PING 1\x01")
+
+	mux := irc.NewServeMux()
+	mux.Handle(irc.PRIVMSG, NewResponder())
+	mux.ServeIRC(irc.NewReplyWriter(irc.NewEncoder(buffer), m, nil), m)
+
+	if buffer.String() != "NOTICE a :\x01PING 1\x01\r\n" {
+		t.Errorf("Wrong reply: %q", buffer.String())
+	}
+}
+
+func TestResponder_rateLimitHandlers(t *testing.T) {
+	r := NewResponder()
+	r.Interval = time.Minute
+
+	calls := 0
+	r.Handle("COUNT", func(m *irc.Message, message string) (string, bool) {
+		calls++
+		return "", true
+	})
+
+	enc := irc.NewEncoder(new(bytes.Buffer))
+	for i := 0; i < 3; i++ {
+		r.Respond(enc, irc.ParseMessage(":a!a@host PRIVMSG bot :\x01COUNT\x01"))
+	}
+
+	if calls != 1 {
+		t.Errorf("Handlers should not run for rate limited senders, got %d calls", calls)
+	}
+}
+
+func TestResponder_ServeIRC_caseMapping(t *testing.T) {
+	isupport := irc.NewISupport()
+	isupport.Update(irc.ParseMessage(":irc.test 005 bot CASEMAPPING=ascii :are supported by this server"))
+
+	r := NewResponder()
+	r.Interval = time.Minute
+
+	buffer := new(bytes.Buffer)
+	for _, raw := range []string{":a[!a@host PRIVMSG bot :\x01PING 1\x01", ":a{!a@host PRIVMSG bot :\x01PING 2\x01"} {
+		m := irc.ParseMessage(raw)
+		r.ServeIRC(irc.NewReplyWriter(irc.NewEncoder(buffer), m, isupport), m)
+	}
+
+	if buffer.String() != "NOTICE a[ :\x01PING 1\x01\r\nNOTICE a{ :\x01PING 2\x01\r\n" {
+		t.Errorf("Senders should be distinct with ascii casemapping: %q", buffer.String())
+	}
+}
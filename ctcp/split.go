@@ -0,0 +1,79 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package ctcp
+
+import (
+	"strings"
+)
+
+// Segment is a part of message text: either plain text or tagged data.
+type Segment struct {
+	Tag     string // CTCP tag, empty for plain text
+	Message string // Plain text, or the message of tagged data
+}
+
+// IsTagged returns true if this segment contains tagged data.
+func (s Segment) IsTagged() bool {
+	return len(s.Tag) > 0
+}
+
+// String returns the segment as message text.
+func (s Segment) String() string {
+	if s.IsTagged() {
+		return Encode(s.Tag, s.Message)
+	}
+	return s.Message
+}
+
+// Split splits message text into plain text and tagged data, in order.
+//
+//    <text>    ::= <segment> {<segment>}
+//    <segment> ::= <plain> | <delim> <tag> [<SPACE> <message>] <delim>
+//
+// Tagged data without a closing delimiter at the end of the text is accepted,
+// as many clients send it that way. Empty tagged data is dropped.
+func Split(text string) (segments []Segment) {
+
+	for len(text) > 0 {
+
+		i := strings.IndexByte(text, delimiter)
+		if i < 0 {
+			return append(segments, Segment{Message: text})
+		}
+		if i > 0 {
+			segments = append(segments, Segment{Message: text[:i]})
+		}
+		text = text[i+1:]
+
+		// Find the end of the tagged data, or use the rest of the text.
+		data := text
+		if i = strings.IndexByte(text, delimiter); i >= 0 {
+			data, text = text[:i], text[i+1:]
+		} else {
+			text = empty
+		}
+
+		s := Segment{Tag: data}
+		if i = strings.IndexByte(data, space); i >= 0 {
+			s.Tag, s.Message = data[:i], data[i+1:]
+		}
+		if s.IsTagged() {
+			segments = append(segments, s)
+		}
+	}
+
+	return segments
+}
+
+// Join returns the message text for segments, reversing Split.
+//
+// Plain text should not contain the CTCP delimiter.
+func Join(segments []Segment) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteString(s.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package dcc
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Chat is a DCC CHAT connection.
+//
+// Messages are sent as lines of text, without IRC framing. Chat implements
+// io.ReadWriteCloser for raw access; ReadLine and WriteLine handle the line
+// delimiters.
+type Chat struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+// NewChat returns a Chat using conn, as returned by Dial or Accept.
+func NewChat(conn net.Conn) *Chat {
+	return &Chat{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// Read reads raw data from the connection.
+func (c *Chat) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// Write writes raw data to the connection.
+func (c *Chat) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.Write(p)
+}
+
+// Close closes the connection.
+func (c *Chat) Close() error {
+	return c.conn.Close()
+}
+
+// Conn returns the underlying connection, for example to set deadlines.
+func (c *Chat) Conn() net.Conn {
+	return c.conn
+}
+
+// ReadLine reads a line of text, without the trailing CR LF or LF.
+func (c *Chat) ReadLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// WriteLine writes a line of text followed by LF. Line breaks in text are
+// replaced by spaces.
+func (c *Chat) WriteLine(text string) error {
+	text = strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+	_, err := c.Write([]byte(text + "\n"))
+	return err
+}
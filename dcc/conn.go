@@ -0,0 +1,53 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package dcc
+
+import (
+	"context"
+	"net"
+)
+
+// Listen listens for the connection of an offer on a random port, and sets
+// the IP and Port of o so it can be sent to the peer.
+//
+// The ip is the address the peer connects to. Behind NAT this is the
+// external address, not the address of the local interface.
+func Listen(o *Offer, ip net.IP) (net.Listener, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	o.IP = ip
+	o.Port = l.Addr().(*net.TCPAddr).Port
+	return l, nil
+}
+
+// Accept waits for a single connection on l, then closes l. Accept returns
+// ctx.Err() if ctx is done first.
+func Accept(ctx context.Context, l net.Listener) (net.Conn, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	conn, err := l.Accept()
+	l.Close()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return conn, err
+}
+
+// Dial connects to the address of an offer.
+func Dial(ctx context.Context, o *Offer) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", o.Addr())
+}
@@ -0,0 +1,392 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package dcc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc/ctcp"
+)
+
+var offerTests = [...]*struct {
+	message string
+	offer   *Offer
+}{
+	{
+		message: "SEND file.txt 2130706433 5000 1234",
+		offer:   &Offer{Type: SEND, Filename: "file.txt", IP: net.IPv4(127, 0, 0, 1).To4(), Port: 5000, Size: 1234},
+	},
+	{
+		message: "SEND \"my file.txt\" 3232235777 5000",
+		offer:   &Offer{Type: SEND, Filename: "my file.txt", IP: net.IPv4(192, 168, 1, 1).To4(), Port: 5000, Size: -1},
+	},
+	{
+		message: "SEND file.txt ::1 5000 1234",
+		offer:   &Offer{Type: SEND, Filename: "file.txt", IP: net.ParseIP("::1"), Port: 5000, Size: 1234},
+	},
+	{
+		message: "SEND file.txt 2130706433 0 1234 42",
+		offer:   &Offer{Type: SEND, Filename: "file.txt", IP: net.IPv4(127, 0, 0, 1).To4(), Size: 1234, Token: "42"},
+	},
+	{
+		message: "CHAT chat 2130706433 5000",
+		offer:   &Offer{Type: CHAT, Filename: "chat", IP: net.IPv4(127, 0, 0, 1).To4(), Port: 5000, Size: -1},
+	},
+	{
+		message: "RESUME file.txt 5000 4096",
+		offer:   &Offer{Type: RESUME, Filename: "file.txt", Port: 5000, Position: 4096, Size: -1},
+	},
+	{
+		message: "ACCEPT file.txt 0 4096 42",
+		offer:   &Offer{Type: ACCEPT, Filename: "file.txt", Position: 4096, Size: -1, Token: "42"},
+	},
+}
+
+var invalidOffers = [...]string{
+	"",
+	"SEND",
+	"SEND file.txt",
+	"SEND file.txt 2130706433",
+	"SEND file.txt 2130706433 0 1234",
+	"SEND file.txt localhost 5000",
+	"SEND file.txt 2130706433 70000",
+	"SEND \"file.txt 2130706433 5000",
+	"SEND file.txt 2130706433 5000 -1",
+	"RESUME file.txt 5000",
+	"FOO file.txt 2130706433 5000",
+}
+
+func TestParseOffer(t *testing.T) {
+	for i, test := range offerTests {
+		o, err := ParseOffer(test.message)
+		if err != nil {
+			t.Errorf("Failed to parse offer %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(o, test.offer) {
+			t.Errorf("Failed to parse offer %d: got %+v", i, o)
+		}
+		if s := o.String(); s != test.message {
+			t.Errorf("Failed to encode offer %d: got %q", i, s)
+		}
+	}
+
+	for i, message := range invalidOffers {
+		if o, err := ParseOffer(message); err != ErrInvalidOffer {
+			t.Errorf("Invalid offer %d should not parse, got %+v %v", i, o, err)
+		}
+	}
+}
+
+func TestParseCTCP(t *testing.T) {
+	o, err := ParseCTCP(ctcp.Encode(Tag, offerTests[0].message))
+	if err != nil || !reflect.DeepEqual(o, offerTests[0].offer) {
+		t.Errorf("Failed to parse CTCP offer: %+v %v", o, err)
+	}
+	if o.CTCP() != "\x01DCC "+offerTests[0].message+"\x01" {
+		t.Errorf("Wrong CTCP text: %q", o.CTCP())
+	}
+	if _, err := ParseCTCP(ctcp.Version("")); err != ErrNotDCC {
+		t.Errorf("Expected ErrNotDCC, got %v", err)
+	}
+}
+
+func TestOffer_Resume(t *testing.T) {
+	offer := offerTests[0].offer
+	resume := offer.Resume(4096)
+	accept := resume.Accept()
+
+	if resume.String() != "RESUME file.txt 5000 4096" || accept.String() != "ACCEPT file.txt 5000 4096" {
+		t.Errorf("Wrong resume negotiation: %q %q", resume, accept)
+	}
+	if !offer.Matches(resume) || !offer.Matches(accept) {
+		t.Errorf("Offer should match its RESUME and ACCEPT")
+	}
+	if offer.Matches(&Offer{Type: RESUME, Filename: "file.txt", Port: 5001}) {
+		t.Errorf("Offer should not match a RESUME for another port")
+	}
+}
+
+// testFile returns random file contents.
+func testFile(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+// testSend transfers data from position between the connections returned
+// by the sender and receiver, and checks the received data.
+func testSend(t *testing.T, data []byte, position int64, sender, receiver func() (net.Conn, error)) {
+	sent := make(chan error, 1)
+
+	go func() {
+		conn, err := sender()
+		if err != nil {
+			sent <- err
+			return
+		}
+		defer conn.Close()
+		n, err := SendFile(context.Background(), conn, bytes.NewReader(data[position:]), position)
+		if err == nil && n != int64(len(data))-position {
+			t.Errorf("SendFile wrote %d bytes", n)
+		}
+		sent <- err
+	}()
+
+	conn, err := receiver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	buffer := new(bytes.Buffer)
+	if _, err := ReceiveFile(conn, buffer, position, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buffer.Bytes(), data[position:]) {
+		t.Errorf("Received data differs, got %d bytes", buffer.Len())
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data := testFile(100000)
+
+	offer := &Offer{Type: SEND, Filename: "file.bin", Size: int64(len(data))}
+	l, err := Listen(offer, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := ParseCTCP(offer.CTCP())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testSend(t, data, 0, func() (net.Conn, error) {
+		return Accept(ctx, l)
+	}, func() (net.Conn, error) {
+		return Dial(ctx, received)
+	})
+}
+
+func TestSendFile_Passive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data := testFile(100000)
+
+	offer := &Offer{Type: SEND, Filename: "file.bin", IP: net.IPv4(127, 0, 0, 1), Size: int64(len(data)), Token: "7"}
+	received, err := ParseCTCP(offer.CTCP())
+	if err != nil || !received.IsPassive() {
+		t.Fatalf("Failed to parse passive offer: %+v %v", received, err)
+	}
+
+	// The receiver listens, and replies with its address.
+	reply := *received
+	l, err := Listen(&reply, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseCTCP(reply.CTCP())
+	if err != nil || !offer.Matches(parsed) {
+		t.Fatalf("Reply should match the offer: %+v %v", parsed, err)
+	}
+
+	testSend(t, data, 0, func() (net.Conn, error) {
+		return Dial(ctx, parsed)
+	}, func() (net.Conn, error) {
+		return Accept(ctx, l)
+	})
+}
+
+func TestSendFile_Resume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data := testFile(100000)
+
+	offer := &Offer{Type: SEND, Filename: "file.bin", Size: int64(len(data))}
+	l, err := Listen(offer, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resume, err := ParseCTCP(offer.Resume(40000).CTCP())
+	if err != nil || !offer.Matches(resume) {
+		t.Fatalf("RESUME should match the offer: %+v %v", resume, err)
+	}
+	accept, err := ParseCTCP(resume.Accept().CTCP())
+	if err != nil || accept.Position != 40000 {
+		t.Fatalf("Failed to parse ACCEPT: %+v %v", accept, err)
+	}
+
+	testSend(t, data, accept.Position, func() (net.Conn, error) {
+		return Accept(ctx, l)
+	}, func() (net.Conn, error) {
+		return Dial(ctx, offer)
+	})
+}
+
+func TestAccept_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l, err := Listen(&Offer{Type: CHAT}, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := Accept(ctx, l); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestChat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	offer := &Offer{Type: CHAT}
+	l, err := Listen(offer, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := ParseCTCP(offer.CTCP())
+	if err != nil || received.Type != CHAT || received.Filename != "chat" {
+		t.Fatalf("Failed to parse CHAT offer: %+v %v", received, err)
+	}
+
+	go func() {
+		conn, err := Accept(ctx, l)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		chat := NewChat(conn)
+		defer chat.Close()
+		for {
+			line, err := chat.ReadLine()
+			if err != nil {
+				return
+			}
+			chat.WriteLine("echo: " + line)
+		}
+	}()
+
+	conn, err := Dial(ctx, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := NewChat(conn)
+	defer chat.Close()
+
+	chat.Write([]byte("hello\r\n"))
+	chat.WriteLine("multi\nline")
+
+	for _, expected := range []string{"echo: hello", "echo: multi line"} {
+		if line, err := chat.ReadLine(); err != nil || line != expected {
+			t.Errorf("Expected %q, got %q %v", expected, line, err)
+		}
+	}
+}
+
+func TestSendFile_stopsReading(t *testing.T) {
+	sender, receiver := net.Pipe()
+	defer sender.Close()
+	defer receiver.Close()
+
+	data := testFile(1000)
+	sent := make(chan struct{})
+
+	go func() {
+		ReceiveFile(receiver, new(bytes.Buffer), 0, int64(len(data)))
+		<-sent
+		receiver.Write([]byte("after"))
+	}()
+
+	_, err := SendFile(context.Background(), sender, bytes.NewReader(data), 0)
+	close(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SendFile should not read data following the acknowledgements.
+	p := make([]byte, 5)
+	sender.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(sender, p); err != nil || string(p) != "after" {
+		t.Errorf("Expected data after the transfer, got %q %v", p, err)
+	}
+}
+
+// eofReader returns all data together with io.EOF.
+type eofReader struct {
+	data []byte
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, io.EOF
+}
+
+func TestReceiveFile_EOF(t *testing.T) {
+	data := testFile(1000)
+	buffer := new(bytes.Buffer)
+
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{&eofReader{data[100:]}, ioutil.Discard}
+
+	if n, err := ReceiveFile(conn, buffer, 100, int64(len(data))); err != nil || n != 900 {
+		t.Errorf("Final data with io.EOF should complete the file, got %d %v", n, err)
+	}
+
+	conn.Reader = &eofReader{data[100:500]}
+	if _, err := ReceiveFile(conn, buffer, 100, int64(len(data))); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestSendFile_stall(t *testing.T) {
+	offer := &Offer{Type: SEND, Filename: "file.bin"}
+	l, err := Listen(offer, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The receiver reads the data, but never acknowledges it.
+	go func() {
+		conn, err := Accept(context.Background(), l)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	conn, err := Dial(context.Background(), offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := SendFile(ctx, conn, bytes.NewReader(testFile(1000)), 0); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+// Package dcc implements Direct Client-to-Client negotiation and transfers.
+//
+// DCC offers are sent as CTCP messages in a PRIVMSG, the actual data is sent
+// over a direct TCP connection between the clients. This package implements
+// DCC SEND for file transfers, including RESUME and ACCEPT, and DCC CHAT.
+//
+// Sending a file, the receiver connects to the sender:
+//
+//    offer := &dcc.Offer{Type: dcc.SEND, Filename: "file.txt", Size: size}
+//    l, err := dcc.Listen(offer, externalIP)
+//    enc.Encode(&irc.Message{Command: irc.PRIVMSG, Params: []string{nick}, Trailing: offer.CTCP()})
+//
+//    conn, err := dcc.Accept(ctx, l)
+//    _, err = dcc.SendFile(ctx, conn, file, 0)
+//
+// Receiving a file:
+//
+//    offer, err := dcc.ParseCTCP(m.Trailing)
+//    conn, err := dcc.Dial(ctx, offer)
+//    _, err = dcc.ReceiveFile(conn, file, 0, offer.Size)
+//
+// Passive (reverse) offers have port 0 and a token. The receiver listens
+// instead, and replies with a copy of the offer containing its address:
+//
+//    reply := *offer
+//    l, err := dcc.Listen(&reply, externalIP)
+//    enc.Encode(&irc.Message{Command: irc.PRIVMSG, Params: []string{nick}, Trailing: reply.CTCP()})
+//
+// To continue a partial download, the receiver sends offer.Resume(position).
+// The sender answers with resume.Accept() and starts sending at position.
+// Use Offer.Matches to find the offer a RESUME or ACCEPT refers to.
+//
+// Filenames in offers come from the peer and must not be used as a path
+// without sanitizing them first.
+package dcc
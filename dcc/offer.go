@@ -0,0 +1,249 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package dcc
+
+// Sources:
+// https://modern.ircdocs.horse/dcc.html
+// http://www.irchelp.org/irchelp/rfc/dccspec.html
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sorcix/irc/ctcp"
+)
+
+// Tag is the CTCP tag used for DCC offers.
+const Tag = "DCC"
+
+// Offer types.
+const (
+	SEND   = "SEND"
+	CHAT   = "CHAT"
+	RESUME = "RESUME"
+	ACCEPT = "ACCEPT"
+)
+
+// Various constants used for formatting DCC offers.
+const (
+	space byte = 0x20 // Separates arguments
+	quote byte = 0x22 // Encloses filenames containing spaces (")
+
+	chatProtocol = "chat" // Argument of CHAT offers in place of a filename
+)
+
+// Errors returned when parsing offers.
+var (
+	ErrNotDCC       = errors.New("dcc: not a DCC offer")
+	ErrInvalidOffer = errors.New("dcc: invalid offer")
+)
+
+// Offer represents a DCC request, sent as CTCP data.
+//
+//    SEND   <filename> <ip> <port> [<size> [<token>]]
+//    CHAT   chat <ip> <port> [<token>]
+//    RESUME <filename> <port> <position> [<token>]
+//    ACCEPT <filename> <port> <position> [<token>]
+//
+// IPv4 addresses are sent as a single 32-bit integer, IPv6 addresses in text
+// form. Passive (reverse) offers use port 0 and a token; the receiver listens
+// and replies with the same offer, including its own address and port.
+type Offer struct {
+	Type     string // SEND, CHAT, RESUME or ACCEPT
+	Filename string // Name of the file, unsafe to use as a path
+	IP       net.IP // Address to connect to, nil for RESUME and ACCEPT
+	Port     int    // Port to connect to, 0 for passive offers
+	Size     int64  // File size for SEND, -1 if unknown
+	Position int64  // Resume position for RESUME and ACCEPT
+	Token    string // Token of a passive offer
+}
+
+// ParseOffer parses the CTCP message of a DCC request, the text following
+// the DCC tag.
+func ParseOffer(message string) (*Offer, error) {
+	o := &Offer{Size: -1}
+
+	i := strings.IndexByte(message, space)
+	if i < 0 {
+		return nil, ErrInvalidOffer
+	}
+	o.Type, message = strings.ToUpper(message[:i]), strings.TrimLeft(message[i+1:], " ")
+
+	// Filenames containing spaces are quoted.
+	if len(message) > 0 && message[0] == quote {
+		if i = strings.IndexByte(message[1:], quote); i < 0 {
+			return nil, ErrInvalidOffer
+		}
+		o.Filename, message = message[1:i+1], message[i+2:]
+	} else if i = strings.IndexByte(message, space); i >= 0 {
+		o.Filename, message = message[:i], message[i+1:]
+	} else {
+		o.Filename, message = message, ""
+	}
+
+	args := strings.Fields(message)
+	var err error
+
+	switch o.Type {
+
+	case SEND, CHAT:
+		if len(args) < 2 {
+			return nil, ErrInvalidOffer
+		}
+		if o.IP = parseIP(args[0]); o.IP == nil {
+			return nil, ErrInvalidOffer
+		}
+		if o.Port, err = parsePort(args[1]); err != nil {
+			return nil, err
+		}
+		args = args[2:]
+		if o.Type == SEND && len(args) > 0 {
+			if o.Size, err = strconv.ParseInt(args[0], 10, 64); err != nil || o.Size < 0 {
+				return nil, ErrInvalidOffer
+			}
+			args = args[1:]
+		}
+
+	case RESUME, ACCEPT:
+		if len(args) < 2 {
+			return nil, ErrInvalidOffer
+		}
+		if o.Port, err = parsePort(args[0]); err != nil {
+			return nil, err
+		}
+		if o.Position, err = strconv.ParseInt(args[1], 10, 64); err != nil || o.Position < 0 {
+			return nil, ErrInvalidOffer
+		}
+		args = args[2:]
+
+	default:
+		return nil, ErrInvalidOffer
+	}
+
+	if len(args) > 0 {
+		o.Token = args[0]
+	}
+
+	if len(o.Filename) <= 0 || (o.Port == 0 && len(o.Token) <= 0 && o.Type != ACCEPT && o.Type != RESUME) {
+		return nil, ErrInvalidOffer
+	}
+
+	return o, nil
+}
+
+// ParseCTCP parses a DCC request from message text.
+func ParseCTCP(text string) (*Offer, error) {
+	tag, message, ok := ctcp.Decode(text)
+	if !ok || tag != Tag {
+		return nil, ErrNotDCC
+	}
+	return ParseOffer(message)
+}
+
+// IsPassive returns true for passive offers, where the receiver listens.
+func (o *Offer) IsPassive() bool {
+	return o.Port == 0 && len(o.Token) > 0
+}
+
+// Addr returns the address to connect to.
+func (o *Offer) Addr() string {
+	return net.JoinHostPort(o.IP.String(), strconv.Itoa(o.Port))
+}
+
+// Resume returns the RESUME request for this SEND offer, asking the sender
+// to start at position.
+func (o *Offer) Resume(position int64) *Offer {
+	return &Offer{
+		Type:     RESUME,
+		Filename: o.Filename,
+		Port:     o.Port,
+		Position: position,
+		Token:    o.Token,
+	}
+}
+
+// Accept returns the ACCEPT reply for this RESUME request.
+func (o *Offer) Accept() *Offer {
+	a := *o
+	a.Type = ACCEPT
+	return &a
+}
+
+// Matches returns true if the RESUME or ACCEPT request r refers to this
+// offer, by port or by token for passive offers.
+func (o *Offer) Matches(r *Offer) bool {
+	if o.IsPassive() {
+		return r.Token == o.Token
+	}
+	return r.Port == o.Port && r.Token == o.Token
+}
+
+// String returns the CTCP message for this offer, without the DCC tag.
+func (o *Offer) String() string {
+	filename := o.Filename
+	if o.Type == CHAT && len(filename) <= 0 {
+		filename = chatProtocol
+	}
+	if strings.IndexByte(filename, space) >= 0 {
+		filename = string(quote) + filename + string(quote)
+	}
+
+	args := []string{o.Type, filename}
+
+	switch o.Type {
+	case SEND, CHAT:
+		args = append(args, formatIP(o.IP), strconv.Itoa(o.Port))
+		if o.Type == SEND && (o.Size >= 0 || len(o.Token) > 0) {
+			size := o.Size
+			if size < 0 {
+				size = 0
+			}
+			args = append(args, strconv.FormatInt(size, 10))
+		}
+	case RESUME, ACCEPT:
+		args = append(args, strconv.Itoa(o.Port), strconv.FormatInt(o.Position, 10))
+	}
+
+	if len(o.Token) > 0 {
+		args = append(args, o.Token)
+	}
+
+	return strings.Join(args, string(space))
+}
+
+// CTCP returns the message text for this offer, to be sent in a PRIVMSG.
+func (o *Offer) CTCP() string {
+	return ctcp.Encode(Tag, o.String())
+}
+
+// parseIP parses an IPv4 address sent as integer, or a textual address.
+func parseIP(s string) net.IP {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(n))
+		return ip
+	}
+	return net.ParseIP(s)
+}
+
+// formatIP formats IPv4 addresses as integer, others in text form.
+func formatIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint32(v4)), 10)
+	}
+	return ip.String()
+}
+
+// parsePort parses a port number, 0 is allowed for passive offers.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, ErrInvalidOffer
+	}
+	return port, nil
+}
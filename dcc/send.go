@@ -0,0 +1,183 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package dcc
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Size of the data blocks written by SendFile and read by ReceiveFile.
+const blockSize = 16 * 1024
+
+// SendFile writes the contents of r to conn, and waits until the receiver
+// acknowledged all data. The file is sent starting at position, r should
+// already be positioned there.
+//
+// Acknowledgements are 32-bit big-endian integers holding the number of
+// bytes received, including position, modulo 2^32. A receiver closing the
+// connection after receiving the data is not an error.
+//
+// Acknowledgements are read in the background while sending. If conn has a
+// SetReadDeadline method, like net.Conn, SendFile stops reading them before
+// it returns. Otherwise the background read continues until conn is closed,
+// so conn must not be used for reading afterwards.
+//
+// SendFile returns ctx.Err() if ctx is done before all data was
+// acknowledged, for example when the receiver stalls. Writes are interrupted
+// too if conn has a SetWriteDeadline method.
+//
+// Returns the number of bytes written. SendFile doesn't close conn.
+func SendFile(ctx context.Context, conn io.ReadWriter, r io.Reader, position int64) (int64, error) {
+	var (
+		last    uint32
+		err     error
+		updated = make(chan struct{}, 1)
+		closed  = make(chan struct{})
+	)
+
+	// Acknowledgements are read while sending, so a receiver blocking on
+	// writing them doesn't stop reading data.
+	go func() {
+		defer close(closed)
+		ack := make([]byte, 4)
+		for {
+			if _, err = io.ReadFull(conn, ack); err != nil {
+				return
+			}
+			atomic.StoreUint32(&last, binary.BigEndian.Uint32(ack))
+			select {
+			case updated <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	defer stopReading(conn, closed)
+
+	stop := interruptWrites(ctx, conn)
+	n, werr := io.CopyBuffer(onlyWriter{conn}, r, make([]byte, blockSize))
+	stop()
+	if werr != nil && ctx.Err() != nil {
+		return n, ctx.Err()
+	}
+	if werr != nil {
+		return n, werr
+	}
+
+	target := uint32(position + n)
+
+	for atomic.LoadUint32(&last) != target {
+		select {
+		case <-updated:
+		case <-closed:
+			if atomic.LoadUint32(&last) == target || err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	}
+
+	return n, nil
+}
+
+// ReceiveFile reads a file sent by SendFile from conn, writing it to w and
+// acknowledging every block. The file is received starting at position, as
+// negotiated using RESUME and ACCEPT.
+//
+// The size is the total file size. If size is not negative, ReceiveFile
+// returns once the file reaches size bytes (size-position bytes received),
+// or io.ErrUnexpectedEOF if the connection closes before that. Otherwise
+// data is read until the sender closes the connection.
+//
+// Returns the number of bytes received. ReceiveFile doesn't close conn.
+func ReceiveFile(conn io.ReadWriter, w io.Writer, position, size int64) (int64, error) {
+	var received int64
+
+	buffer := make([]byte, blockSize)
+	ack := make([]byte, 4)
+
+	for size < 0 || position+received < size {
+		p := buffer
+		if size >= 0 && size-position-received < int64(len(p)) {
+			p = p[:size-position-received]
+		}
+
+		n, err := conn.Read(p)
+		if n > 0 {
+			if _, werr := w.Write(p[:n]); werr != nil {
+				return received, werr
+			}
+			received += int64(n)
+
+			binary.BigEndian.PutUint32(ack, uint32(position+received))
+			if _, werr := conn.Write(ack); werr != nil {
+				return received, werr
+			}
+		}
+
+		if err == io.EOF {
+			if size >= 0 && position+received < size {
+				return received, io.ErrUnexpectedEOF
+			}
+			return received, nil
+		}
+		if err != nil {
+			return received, err
+		}
+	}
+
+	return received, nil
+}
+
+// stopReading interrupts the read of conn that closes closed when it returns,
+// and waits for it. Nothing is done if conn doesn't support read deadlines.
+func stopReading(conn io.Reader, closed <-chan struct{}) {
+	d, ok := conn.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return
+	}
+	d.SetReadDeadline(time.Unix(1, 0))
+	<-closed
+	d.SetReadDeadline(time.Time{})
+}
+
+// interruptWrites sets a write deadline in the past when ctx is done, if conn
+// supports write deadlines. The returned function stops watching ctx and
+// clears the deadline.
+func interruptWrites(ctx context.Context, conn io.Writer) (stop func()) {
+	d, ok := conn.(interface{ SetWriteDeadline(time.Time) error })
+	if !ok || ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			d.SetWriteDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+		d.SetWriteDeadline(time.Time{})
+	}
+}
+
+// onlyWriter hides the ReadFrom method of connections, so io.CopyBuffer
+// writes in blocks instead of using sendfile.
+type onlyWriter struct {
+	io.Writer
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DialConfig contains the settings for DialWithConfig.
+type DialConfig struct {
+	// When set, the connection uses TLS. Use Certificates for client
+	// certificates (SASL EXTERNAL, CertFP) and RootCAs for custom roots.
+	// An empty ServerName is set to the host being dialed.
+	TLSConfig *tls.Config
+
+	// Dialer used to connect, the zero net.Dialer if nil.
+	Dialer *net.Dialer
+
+	// When set, connections to hosts with a stored STS policy are upgraded
+	// to TLS, and Register stores policies advertised by the server.
+	STSStore STSStore
+}
+
+// DialTLS connects to the given address using TLS and then returns a new
+// Conn for the connection. A nil config uses the default settings.
+func DialTLS(addr string, config *tls.Config) (*Conn, error) {
+	if config == nil {
+		config = new(tls.Config)
+	}
+	return DialWithConfig(context.Background(), addr, &DialConfig{TLSConfig: config})
+}
+
+// DialWithConfig connects to the given address using config and then
+// returns a new Conn for the connection.
+//
+// If an STSStore is configured and holds an unexpired policy for the host,
+// the connection is made using TLS on the port from the policy, even if
+// config has no TLSConfig. Such connections never fall back to plaintext.
+func DialWithConfig(ctx context.Context, addr string, config *DialConfig) (*Conn, error) {
+	host, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, &net.AddrError{Err: "invalid port", Addr: addr}
+	}
+	host = strings.ToLower(host)
+
+	tlsConfig := config.TLSConfig
+
+	if config.STSStore != nil {
+		policy, err := config.STSStore.Load(host)
+		if err != nil {
+			return nil, err
+		}
+		if policy != nil && !policy.Expired() {
+			if tlsConfig == nil {
+				tlsConfig = new(tls.Config)
+			}
+			if policy.Port > 0 {
+				port = policy.Port
+			}
+		}
+	}
+
+	dialer := config.Dialer
+	if dialer == nil {
+		dialer = new(net.Dialer)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		if len(tlsConfig.ServerName) <= 0 {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+
+		stop := watchDeadline(ctx, conn.SetDeadline)
+		err = tlsConn.Handshake()
+		stop()
+
+		if err != nil {
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c := NewConn(conn)
+	c.host, c.port = host, port
+	c.secure = tlsConfig != nil
+	c.sts = config.STSStore
+
+	return c, nil
+}
@@ -12,6 +12,11 @@
 //    // Translate back to a raw IRC message string:
 //    raw = message.String()
 //
+// ParseMessage returns nil for invalid messages. Use ParseMessageStrict to
+// find out why a message could not be parsed:
+//
+//    message, err := irc.ParseMessageStrict(raw)
+//
 // Decoder and Encoder can be used to decode and encode messages in a stream:
 //
 //    // Create a decoder that reads from given io.Reader
@@ -30,7 +35,22 @@
 //
 //    c, err := irc.Dial("irc.server.net:6667")
 //
+//    // Or use TLS, see DialWithConfig for client certificates and STS
+//    c, err := irc.DialTLS("irc.server.net:6697", nil)
+//
 //    // Methods from both Encoder and Decoder are available
 //    message, err := c.Decode()
 //
+// Register takes care of the registration handshake after connecting:
+//
+//    welcome, err := c.Register(ctx, irc.RegistrationConfig{Nick: "bot"})
+//
+// ServeMux routes incoming messages to handlers, much like net/http:
+//
+//    mux := irc.NewServeMux()
+//    mux.HandleFunc("PRIVMSG", func(w *irc.ReplyWriter, m *irc.Message) {
+//        w.Reply("Hello!")
+//    })
+//    err = irc.Serve(c, mux)
+//
 package irc
@@ -0,0 +1,125 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reasons used in ParseError.
+var (
+	ErrEmptyMessage   = errors.New("empty message")
+	ErrEmptyTags      = errors.New("empty tags")
+	ErrEmptyPrefix    = errors.New("empty prefix")
+	ErrMissingCommand = errors.New("missing command")
+	ErrInvalidNumeric = errors.New("invalid numeric")
+	ErrNULByte        = errors.New("NUL byte")
+	ErrLineTooLong    = errors.New("line too long")
+)
+
+// ParseError describes why a raw IRC message could not be parsed.
+type ParseError struct {
+	Raw    string // The raw message
+	Offset int    // Byte offset in Raw where the problem was detected
+	Err    error  // Reason, one of the Err* values above
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("irc: invalid message at offset %d: %s", e.Offset, e.Err.Error())
+}
+
+// Unwrap returns the reason of this error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseMessageStrict takes a string and attempts to create a Message struct.
+//
+// Unlike ParseMessage, this function returns a *ParseError explaining why the
+// message is invalid. It also rejects messages that ParseMessage accepts, such
+// as messages without a command, malformed numerics and messages containing
+// NUL bytes.
+func ParseMessageStrict(raw string) (*Message, error) {
+
+	if i := indexByte(raw, 0); i >= 0 {
+		return nil, &ParseError{raw, i, ErrNULByte}
+	}
+
+	// Offsets are reported relative to raw, not to the trimmed line.
+	line := strings.TrimLeftFunc(raw, cutsetFunc)
+	start := len(raw) - len(line)
+
+	if line = strings.TrimRightFunc(line, cutsetFunc); len(line) <= 0 {
+		return nil, &ParseError{raw, 0, ErrEmptyMessage}
+	}
+
+	i := 0
+
+	if line[0] == tagPrefix {
+		j := indexByte(line, space)
+
+		switch {
+		case j < 0:
+			return nil, &ParseError{raw, start + len(line), ErrMissingCommand}
+		case j < 2:
+			return nil, &ParseError{raw, start + 1, ErrEmptyTags}
+		}
+
+		i = j + 1
+	}
+
+	if i < len(line) && line[i] == prefix {
+		j := indexByte(line[i:], space)
+
+		switch {
+		case j < 0:
+			return nil, &ParseError{raw, start + len(line), ErrMissingCommand}
+		case j < 2:
+			return nil, &ParseError{raw, start + i + 1, ErrEmptyPrefix}
+		}
+
+		i = i + j + 1
+	}
+
+	if i >= len(line) || line[i] == space {
+		return nil, &ParseError{raw, start + i, ErrMissingCommand}
+	}
+
+	command := line[i:]
+	if j := indexByte(command, space); j >= 0 {
+		command = command[:j]
+	}
+
+	if !validNumeric(command) {
+		return nil, &ParseError{raw, start + i, ErrInvalidNumeric}
+	}
+
+	m := ParseMessage(line)
+	if m == nil {
+		return nil, &ParseError{raw, start + i, ErrMissingCommand}
+	}
+
+	return m, nil
+}
+
+// validNumeric returns false if command starts with a digit, but is not a
+// three digit numeric reply.
+func validNumeric(command string) bool {
+	if command[0] < '0' || command[0] > '9' {
+		return true
+	}
+	if len(command) != 3 {
+		return false
+	}
+	for i := 1; i < len(command); i++ {
+		if command[i] < '0' || command[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
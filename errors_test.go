@@ -0,0 +1,83 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var parseErrorTests = [...]*struct {
+	raw    string
+	offset int
+	err    error
+}{
+	{"", 0, ErrEmptyMessage},
+	{"\r\n", 0, ErrEmptyMessage},
+	{": PRIVMSG test :Invalid message with empty prefix.", 1, ErrEmptyPrefix},
+	{":prefix", 7, ErrMissingCommand},
+	{":prefix  PRIVMSG", 8, ErrMissingCommand},
+	{"@ PRIVMSG #test", 1, ErrEmptyTags},
+	{"@a=b :prefix 12 test", 13, ErrInvalidNumeric},
+	{"1234 test", 0, ErrInvalidNumeric},
+	{"PRIVMSG #test :NUL\x00byte", 18, ErrNULByte},
+}
+
+func TestParseMessageStrict_errors(t *testing.T) {
+	for i, test := range parseErrorTests {
+		m, err := ParseMessageStrict(test.raw)
+
+		perr, ok := err.(*ParseError)
+		if m != nil || !ok {
+			t.Errorf("Message %d should return a *ParseError, got %v", i, err)
+			continue
+		}
+
+		if perr.Err != test.err || perr.Offset != test.offset || perr.Raw != test.raw {
+			t.Errorf("Wrong error for message %d:", i)
+			t.Logf("Output: %d %v", perr.Offset, perr.Err)
+			t.Logf("Expected: %d %v", test.offset, test.err)
+		}
+	}
+}
+
+func TestParseMessageStrict(t *testing.T) {
+	for i, test := range messageTests {
+
+		// Skip invalid messages
+		if test.parsed == nil {
+			continue
+		}
+
+		m, err := ParseMessageStrict(test.rawMessage + "\r\n")
+		if err != nil || !reflect.DeepEqual(m, test.parsed) {
+			t.Errorf("Failed to parse message %d: %v", i, err)
+		}
+	}
+}
+
+func TestDecoder_Decode_errors(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(":prefix\r\n\r\nPING test\r\n"))
+	dec.Strict = true
+
+	if m, err := dec.Decode(); m != nil || err == nil {
+		t.Fatal("Strict Decode should return an error for an invalid message")
+	}
+
+	// The empty line is skipped.
+	if m, err := dec.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Decode should continue after an invalid message: %v", err)
+	}
+
+	dec = NewDecoder(strings.NewReader("\r\n:prefix\r\n\r\nPING test\r\n"))
+
+	if m, err := dec.Decode(); m != nil || err != nil {
+		t.Fatal("Decode should return nil without an error by default")
+	}
+	if m, err := dec.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Decode should skip empty lines: %v", err)
+	}
+}
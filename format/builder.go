@@ -0,0 +1,233 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Written between a colour code and text that would otherwise be read as
+// part of the colours. Toggling bold twice changes nothing.
+const colorEscape = "\x02\x02"
+
+// Builder builds formatted text, to be sent in a PRIVMSG or NOTICE.
+//
+// Builder keeps track of the current style and only writes the formatting
+// characters needed. Text starting with a digit or comma right after a
+// colour code is escaped, so it is not read as a colour:
+//
+//    var b format.Builder
+//    b.SetForeground(format.Red)
+//    b.WriteString("1st place")
+//    b.ResetStyle()
+//    b.String() // "\x0304\x02\x021st place\x0F"
+//
+// The zero value is an empty Builder ready to use.
+type Builder struct {
+	b     strings.Builder
+	style Style
+	last  byte // Last formatting character written, if followed by colours
+}
+
+// String returns the formatted text.
+func (b *Builder) String() string {
+	return b.b.String()
+}
+
+// Len returns the number of bytes written.
+func (b *Builder) Len() int {
+	return b.b.Len()
+}
+
+// Style returns the current style.
+func (b *Builder) Style() Style {
+	return b.style
+}
+
+// WriteString writes text using the current style. Formatting characters
+// in text are not removed, use Strip first for untrusted text.
+func (b *Builder) WriteString(text string) {
+	if len(text) <= 0 {
+		return
+	}
+	if b.extendsColor(text[0]) {
+		b.b.WriteString(colorEscape)
+	}
+	b.last = 0
+	b.b.WriteString(text)
+}
+
+// WriteSpan writes the text of span using its style.
+func (b *Builder) WriteSpan(span Span) {
+	b.SetStyle(span.Style)
+	b.WriteString(span.Text)
+}
+
+// SetStyle writes the formatting characters needed to change the current
+// style to s.
+func (b *Builder) SetStyle(s Style) {
+	if s == b.style {
+		return
+	}
+	if s.IsPlain() {
+		b.ResetStyle()
+		return
+	}
+
+	cur := b.style
+	b.toggle(cur.Bold != s.Bold, Bold)
+	b.toggle(cur.Italic != s.Italic, Italic)
+	b.toggle(cur.Underline != s.Underline, Underline)
+	b.toggle(cur.Strikethrough != s.Strikethrough, Strikethrough)
+	b.toggle(cur.Monospace != s.Monospace, Monospace)
+	b.toggle(cur.Reverse != s.Reverse, Reverse)
+
+	if cur.Foreground != s.Foreground || cur.Background != s.Background {
+		b.SetColors(s.Foreground, s.Background)
+		s.Foreground, s.Background = b.style.Foreground, b.style.Background
+	}
+
+	b.style = s
+}
+
+// ResetStyle resets all formatting.
+func (b *Builder) ResetStyle() {
+	if !b.style.IsPlain() {
+		b.writeCode(Reset)
+		b.style = Style{}
+	}
+}
+
+// ToggleBold toggles bold text.
+func (b *Builder) ToggleBold() {
+	b.style.Bold = !b.style.Bold
+	b.writeCode(Bold)
+}
+
+// ToggleItalic toggles italic text.
+func (b *Builder) ToggleItalic() {
+	b.style.Italic = !b.style.Italic
+	b.writeCode(Italic)
+}
+
+// ToggleUnderline toggles underlined text.
+func (b *Builder) ToggleUnderline() {
+	b.style.Underline = !b.style.Underline
+	b.writeCode(Underline)
+}
+
+// ToggleStrikethrough toggles strikethrough text.
+func (b *Builder) ToggleStrikethrough() {
+	b.style.Strikethrough = !b.style.Strikethrough
+	b.writeCode(Strikethrough)
+}
+
+// ToggleMonospace toggles monospace text.
+func (b *Builder) ToggleMonospace() {
+	b.style.Monospace = !b.style.Monospace
+	b.writeCode(Monospace)
+}
+
+// ToggleReverse toggles reversed colours.
+func (b *Builder) ToggleReverse() {
+	b.style.Reverse = !b.style.Reverse
+	b.writeCode(Reverse)
+}
+
+// SetForeground sets the text colour, keeping the background colour.
+func (b *Builder) SetForeground(fg Color) {
+	b.SetColors(fg, b.style.Background)
+}
+
+// SetColors sets the text and background colour.
+//
+// mIRC colours are written using the colour code, RGB colours using the hex
+// colour code. The hex colour code always sets the text colour, a default
+// text colour is written as black if the background is an RGB colour.
+func (b *Builder) SetColors(fg, bg Color) {
+	keepBg := bg.IsDefault() && !b.style.Background.IsDefault()
+
+	switch {
+	case fg.IsDefault() && bg.IsDefault():
+		b.writeCode(ColorCode)
+
+	case fg.kind == colorRGB || bg.kind == colorRGB:
+		// The hex colour code can't reset the background colour.
+		if keepBg {
+			b.writeCode(ColorCode)
+		}
+		if fg.IsDefault() {
+			fg = Black
+		}
+		b.writeCode(HexColorCode)
+		b.b.WriteString(hex(fg))
+		if !bg.IsDefault() {
+			b.b.WriteByte(comma)
+			b.b.WriteString(hex(bg))
+		}
+
+	default:
+		b.writeCode(ColorCode)
+		b.b.WriteString(index(fg))
+		if !bg.IsDefault() || keepBg {
+			b.b.WriteByte(comma)
+			b.b.WriteString(index(bg))
+		}
+	}
+
+	b.style.Foreground, b.style.Background = fg, bg
+}
+
+// toggle writes code if changed is set.
+func (b *Builder) toggle(changed bool, code byte) {
+	if changed {
+		b.writeCode(code)
+	}
+}
+
+// writeCode writes a formatting character.
+func (b *Builder) writeCode(code byte) {
+	b.b.WriteByte(code)
+	b.last = code
+}
+
+// extendsColor returns true if c could be read as part of the colours
+// written last.
+func (b *Builder) extendsColor(c byte) bool {
+	switch b.last {
+	case ColorCode:
+		return isDigit(c) || c == comma
+	case HexColorCode:
+		_, ok := hexDigit(c)
+		return ok || c == comma
+	}
+	return false
+}
+
+// hex returns the six hex digits of c.
+func hex(c Color) string {
+	r, g, bl := c.RGB()
+	return fmt.Sprintf("%02X%02X%02X", r, g, bl)
+}
+
+// index returns the two digit mIRC colour number of c, 99 for the default
+// colour.
+func index(c Color) string {
+	n, ok := c.Index()
+	if !ok {
+		n = 99
+	}
+	return fmt.Sprintf("%02d", n)
+}
+
+// Format returns formatted text for spans, the reverse of Parse.
+func Format(spans []Span) string {
+	var b Builder
+	for _, span := range spans {
+		b.WriteSpan(span)
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package format
+
+import (
+	"fmt"
+)
+
+// Kinds of colours.
+const (
+	colorDefault uint8 = iota
+	colorIndexed
+	colorRGB
+)
+
+// Color is a text or background colour: one of the 99 mIRC colours, or an
+// RGB colour set using the hex colour code. The zero value is the default
+// colour of the client.
+type Color struct {
+	kind  uint8
+	value uint32
+}
+
+// Default is the default colour of the client.
+var Default = Color{}
+
+// The 16 basic mIRC colours.
+var (
+	White      = Indexed(0)
+	Black      = Indexed(1)
+	Blue       = Indexed(2)
+	Green      = Indexed(3)
+	Red        = Indexed(4)
+	Brown      = Indexed(5)
+	Magenta    = Indexed(6)
+	Orange     = Indexed(7)
+	Yellow     = Indexed(8)
+	LightGreen = Indexed(9)
+	Cyan       = Indexed(10)
+	LightCyan  = Indexed(11)
+	LightBlue  = Indexed(12)
+	Pink       = Indexed(13)
+	Grey       = Indexed(14)
+	LightGrey  = Indexed(15)
+)
+
+// Indexed returns mIRC colour n. Colour 99 and numbers outside 0 to 98
+// return the default colour.
+func Indexed(n int) Color {
+	if n < 0 || n >= len(palette) {
+		return Default
+	}
+	return Color{colorIndexed, uint32(n)}
+}
+
+// RGB returns the colour with given red, green and blue components.
+func RGB(r, g, b uint8) Color {
+	return Color{colorRGB, uint32(r)<<16 | uint32(g)<<8 | uint32(b)}
+}
+
+// IsDefault returns true for the default colour.
+func (c Color) IsDefault() bool {
+	return c.kind == colorDefault
+}
+
+// Index returns the mIRC colour number, ok is false for the default colour
+// and RGB colours.
+func (c Color) Index() (n int, ok bool) {
+	return int(c.value), c.kind == colorIndexed
+}
+
+// RGB returns the red, green and blue components of this colour. mIRC
+// colours are converted using the common palette, the default colour
+// returns black.
+func (c Color) RGB() (r, g, b uint8) {
+	v := c.value
+	if c.kind == colorIndexed {
+		v = palette[c.value]
+	} else if c.kind == colorDefault {
+		v = 0
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v)
+}
+
+// Hex returns the colour as "#RRGGBB", or an empty string for the default
+// colour.
+func (c Color) Hex() string {
+	if c.IsDefault() {
+		return ""
+	}
+	r, g, b := c.RGB()
+	return fmt.Sprintf("#%02X%02X%02X", r, g, b)
+}
+
+// String returns the mIRC colour number, the hex colour or "default".
+func (c Color) String() string {
+	switch c.kind {
+	case colorIndexed:
+		return fmt.Sprintf("%02d", c.value)
+	case colorRGB:
+		return c.Hex()
+	}
+	return "default"
+}
+
+// RGB values of the mIRC colours 0 to 98.
+var palette = [...]uint32{
+	0xFFFFFF, 0x000000, 0x00007F, 0x009300, 0xFF0000, 0x7F0000, 0x9C009C, 0xFC7F00,
+	0xFFFF00, 0x00FC00, 0x009393, 0x00FFFF, 0x0000FC, 0xFF00FF, 0x7F7F7F, 0xD2D2D2,
+	0x470000, 0x472100, 0x474700, 0x324700, 0x004700, 0x00472C, 0x004747, 0x002747, 0x000047, 0x2E0047, 0x470047, 0x47002A,
+	0x740000, 0x743A00, 0x747400, 0x517400, 0x007400, 0x007449, 0x007474, 0x004074, 0x000074, 0x4B0074, 0x740074, 0x740045,
+	0xB50000, 0xB56300, 0xB5B500, 0x7DB500, 0x00B500, 0x00B571, 0x00B5B5, 0x0063B5, 0x0000B5, 0x7500B5, 0xB500B5, 0xB5006B,
+	0xFF0000, 0xFF8C00, 0xFFFF00, 0xB2FF00, 0x00FF00, 0x00FFA0, 0x00FFFF, 0x008CFF, 0x0000FF, 0xA500FF, 0xFF00FF, 0xFF0098,
+	0xFF5959, 0xFFB459, 0xFFFF71, 0xCFFF60, 0x6FFF6F, 0x65FFC9, 0x6DFFFF, 0x59B4FF, 0x5959FF, 0xC459FF, 0xFF66FF, 0xFF59BC,
+	0xFF9C9C, 0xFFD39C, 0xFFFF9C, 0xE2FF9C, 0x9CFF9C, 0x9CFFDB, 0x9CFFFF, 0x9CD3FF, 0x9C9CFF, 0xDC9CFF, 0xFF9CFF, 0xFF94D3,
+	0x000000, 0x131313, 0x282828, 0x363636, 0x4D4D4D, 0x656565, 0x818181, 0x9F9F9F, 0xBCBCBC, 0xE2E2E2, 0xFFFFFF,
+}
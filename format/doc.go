@@ -0,0 +1,34 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+// Package format implements the mIRC text formatting codes.
+//
+// Message text may contain formatting characters for bold, italics,
+// underline, strikethrough, monospace, reversed colours and colours. This
+// package parses formatted text into spans, removes the formatting for logs
+// and converts it to ANSI terminal escape sequences or HTML.
+//
+// Example using the irc.Message type:
+//
+//    m := irc.ParseMessage(...)
+//
+//    log.Print(format.Strip(m.Trailing))
+//
+//    for _, span := range format.Parse(m.Trailing) {
+//        if span.Bold {
+//            // This text is bold.
+//        }
+//    }
+//
+// Use a Builder to write formatted text:
+//
+//    var b format.Builder
+//    b.ToggleBold()
+//    b.WriteString("Score:")
+//    b.ToggleBold()
+//    b.SetColors(format.White, format.Green)
+//    b.WriteString("42")
+//
+//    m.Trailing = b.String()
+package format
@@ -0,0 +1,236 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package format
+
+// Sources:
+// https://modern.ircdocs.horse/formatting.html
+
+import (
+	"strings"
+)
+
+// Formatting characters.
+const (
+	Bold          byte = 0x02 // Toggles bold
+	ColorCode     byte = 0x03 // Sets colours: \x03<fg>[,<bg>], resets them without numbers
+	HexColorCode  byte = 0x04 // Sets colours: \x04<RRGGBB>[,<RRGGBB>], resets them without digits
+	Reset         byte = 0x0F // Resets all formatting
+	Monospace     byte = 0x11 // Toggles monospace
+	Reverse       byte = 0x16 // Toggles reversed colours
+	Italic        byte = 0x1D // Toggles italics
+	Strikethrough byte = 0x1E // Toggles strikethrough
+	Underline     byte = 0x1F // Toggles underline
+)
+
+// Various constants used for parsing colour codes.
+const (
+	comma byte = 0x2C // Separates the foreground and background colour
+
+	colorDigits    = 2 // Maximum number of digits in a colour number
+	hexColorDigits = 6 // Number of digits in a hex colour
+)
+
+// Style is the formatting of text. The zero value is unformatted text.
+type Style struct {
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strikethrough bool
+	Monospace     bool
+	Reverse       bool // Swap foreground and background colour
+	Foreground    Color
+	Background    Color
+}
+
+// IsPlain returns true if the style has no formatting.
+func (s Style) IsPlain() bool {
+	return s == Style{}
+}
+
+// Span is a piece of text with a single style.
+type Span struct {
+	Style
+	Text string
+}
+
+// Parse splits text into spans of equally formatted text, removing the
+// formatting characters. Spans never contain empty text.
+func Parse(text string) (spans []Span) {
+	var (
+		style Style
+		start int
+		b     strings.Builder
+	)
+
+	// Adds the text collected so far as a span with the current style.
+	flush := func() {
+		if b.Len() <= 0 {
+			return
+		}
+		if n := len(spans) - 1; n >= 0 && spans[n].Style == style {
+			spans[n].Text += b.String()
+		} else {
+			spans = append(spans, Span{style, b.String()})
+		}
+		b.Reset()
+	}
+
+	for i := 0; i < len(text); {
+		if !isCode(text[i]) {
+			i++
+			continue
+		}
+
+		b.WriteString(text[start:i])
+		c := text[i]
+		i++
+
+		// Applies the new style to text following this code.
+		next := style
+
+		switch c {
+		case Bold:
+			next.Bold = !next.Bold
+		case Italic:
+			next.Italic = !next.Italic
+		case Underline:
+			next.Underline = !next.Underline
+		case Strikethrough:
+			next.Strikethrough = !next.Strikethrough
+		case Monospace:
+			next.Monospace = !next.Monospace
+		case Reverse:
+			next.Reverse = !next.Reverse
+		case Reset:
+			next = Style{}
+		case ColorCode:
+			i = parseColor(text, i, &next, colorDigits, parseIndexed)
+		case HexColorCode:
+			i = parseColor(text, i, &next, hexColorDigits, parseHex)
+		}
+
+		if next != style {
+			flush()
+			style = next
+		}
+		start = i
+	}
+
+	b.WriteString(text[start:])
+	flush()
+
+	return spans
+}
+
+// Strip removes all formatting characters from text.
+func Strip(text string) string {
+	if indexCode(text) < 0 {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, span := range Parse(text) {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
+
+// isCode returns true for formatting characters.
+func isCode(c byte) bool {
+	switch c {
+	case Bold, ColorCode, HexColorCode, Reset, Monospace, Reverse, Italic, Strikethrough, Underline:
+		return true
+	}
+	return false
+}
+
+// indexCode returns the index of the first formatting character in text,
+// or -1 if there is none.
+func indexCode(text string) int {
+	for i := 0; i < len(text); i++ {
+		if isCode(text[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseColor parses the colours following a colour code at text[i:], and
+// sets them in style. The colour values have up to max digits, accepted by
+// parse. A code without colours resets both colours.
+//
+// Returns the index of the first character after the colours.
+func parseColor(text string, i int, style *Style, max int, parse func(string) (Color, int)) int {
+	fg, n := parse(limit(text[i:], max))
+	if n <= 0 {
+		style.Foreground, style.Background = Default, Default
+		return i
+	}
+	style.Foreground = fg
+	i += n
+
+	// The comma is part of the text if no background colour follows.
+	if i+1 < len(text) && text[i] == comma {
+		if bg, n := parse(limit(text[i+1:], max)); n > 0 {
+			style.Background = bg
+			i += n + 1
+		}
+	}
+
+	return i
+}
+
+// parseIndexed parses an mIRC colour number at the start of s, returning
+// the colour and the number of digits.
+func parseIndexed(s string) (Color, int) {
+	n, value := 0, 0
+	for n < len(s) && isDigit(s[n]) {
+		value = value*10 + int(s[n]-'0')
+		n++
+	}
+	return Indexed(value), n
+}
+
+// parseHex parses a hex colour of exactly six digits, returning the colour
+// and the number of digits.
+func parseHex(s string) (Color, int) {
+	if len(s) < hexColorDigits {
+		return Default, 0
+	}
+	var value uint32
+	for i := 0; i < hexColorDigits; i++ {
+		d, ok := hexDigit(s[i])
+		if !ok {
+			return Default, 0
+		}
+		value = value<<4 | uint32(d)
+	}
+	return RGB(uint8(value>>16), uint8(value>>8), uint8(value)), hexColorDigits
+}
+
+// limit returns at most n bytes of s.
+func limit(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case isDigit(c):
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,191 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package format
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseTests = [...]*struct {
+	text  string
+	spans []Span
+}{
+	{
+		text:  "plain text",
+		spans: []Span{{Text: "plain text"}},
+	},
+	{
+		text: "\x02bold\x02 \x1Ditalic\x1D \x1Funderline\x1F \x1Estrike\x1E \x11mono\x11 \x16rev",
+		spans: []Span{
+			{Style{Bold: true}, "bold"},
+			{Style{}, " "},
+			{Style{Italic: true}, "italic"},
+			{Style{}, " "},
+			{Style{Underline: true}, "underline"},
+			{Style{}, " "},
+			{Style{Strikethrough: true}, "strike"},
+			{Style{}, " "},
+			{Style{Monospace: true}, "mono"},
+			{Style{}, " "},
+			{Style{Reverse: true}, "rev"},
+		},
+	},
+	{
+		text: "\x02\x1Dboth\x0F reset",
+		spans: []Span{
+			{Style{Bold: true, Italic: true}, "both"},
+			{Style{}, " reset"},
+		},
+	},
+	{
+		text: "\x034red\x0304,02 on blue\x03 default",
+		spans: []Span{
+			{Style{Foreground: Red}, "red"},
+			{Style{Foreground: Red, Background: Blue}, " on blue"},
+			{Style{}, " default"},
+		},
+	},
+	{
+		// At most two digits, the comma is text without background.
+		text: "\x03123\x034, \x0399,5x",
+		spans: []Span{
+			{Style{Foreground: LightBlue}, "3"},
+			{Style{Foreground: Red}, ", "},
+			{Style{Background: Brown}, "x"},
+		},
+	},
+	{
+		text: "\x0352extended \x03,5comma",
+		spans: []Span{
+			{Style{Foreground: Indexed(52)}, "extended "},
+			{Style{}, ",5comma"},
+		},
+	},
+	{
+		text: "\x04FF8000orange\x04ff8000,000000 on black\x04 \x04ABCDE",
+		spans: []Span{
+			{Style{Foreground: RGB(0xFF, 0x80, 0x00)}, "orange"},
+			{Style{Foreground: RGB(0xFF, 0x80, 0x00), Background: RGB(0, 0, 0)}, " on black"},
+			{Style{}, " ABCDE"},
+		},
+	},
+	{
+		text:  "\x02\x02\x03\x0F",
+		spans: nil,
+	},
+}
+
+func TestParse(t *testing.T) {
+	for i, test := range parseTests {
+		if spans := Parse(test.text); !reflect.DeepEqual(spans, test.spans) {
+			t.Errorf("Failed to parse %d: got %+v", i, spans)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := map[string]string{
+		"plain":                      "plain",
+		"\x02bold\x0F":               "bold",
+		"\x0304,12colour\x03 text":   "colour text",
+		"\x03123":                    "3",
+		"\x04FF0000,00FF00hex\x04":   "hex",
+		"\x1D\x1F\x1E\x11\x16styles": "styles",
+		"\x0312,\x02\x02,5 not a bg": ",,5 not a bg",
+	}
+
+	for text, expected := range tests {
+		if s := Strip(text); s != expected {
+			t.Errorf("Strip(%q): expected %q, got %q", text, expected, s)
+		}
+	}
+}
+
+func TestANSI(t *testing.T) {
+	tests := map[string]string{
+		"plain":                     "plain",
+		"\x02bold\x02 text":         "\x1b[0;1mbold\x1b[0m text",
+		"\x0304,02red\x0F":          "\x1b[0;91;44mred\x1b[0m",
+		"\x0352x\x04FF8000y":        "\x1b[0;38;2;255;0;0mx\x1b[0;38;2;255;128;0my\x1b[0m",
+		"\x1D\x1F\x1E\x16all":       "\x1b[0;3;4;7;9mall\x1b[0m",
+		"evil\x1b[2J escape\ttab\r": "evil[2J escape\ttab",
+	}
+
+	for text, expected := range tests {
+		if s := ANSI(text); s != expected {
+			t.Errorf("ANSI(%q): expected %q, got %q", text, expected, s)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tests := map[string]string{
+		"<b>&amp;</b>":             "&lt;b&gt;&amp;amp;&lt;/b&gt;",
+		"\x02bold\x02 text":        `<span style="font-weight:bold">bold</span> text`,
+		"\x0304,01<red>":           `<span style="color:#FF0000;background-color:#000000">&lt;red&gt;</span>`,
+		"\x0304\x16reverse":        `<span style="background-color:#FF0000">reverse</span>`,
+		"\x1F\x1E\x11\x1Dstyled":   `<span style="font-style:italic;text-decoration:underline line-through;font-family:monospace">styled</span>`,
+		"\x04\"onload=x\"":         "&#34;onload=x&#34;",
+		"nul\x00 and\x01 ctcp\x7F": "nul and ctcp",
+	}
+
+	for text, expected := range tests {
+		if s := HTML(text); s != expected {
+			t.Errorf("HTML(%q): expected %q, got %q", text, expected, s)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+
+	b.SetForeground(Red)
+	b.WriteString("1st")
+	b.SetColors(Red, Blue)
+	b.WriteString(",2nd")
+	b.SetForeground(Green)
+	b.WriteString(" green")
+	b.SetColors(Green, Default)
+	b.WriteString(" no bg")
+	b.ToggleBold()
+	b.WriteString(" bold")
+	b.SetColors(RGB(0xAB, 0xCD, 0xEF), Default)
+	b.WriteString("cafe")
+	b.ResetStyle()
+	b.WriteString(" plain")
+
+	expected := "\x0304\x02\x021st\x0304,02\x02\x02,2nd\x0303,02 green\x0303,99 no bg\x02 bold\x04ABCDEF\x02\x02cafe\x0F plain"
+	if b.String() != expected {
+		t.Errorf("Wrong output:\n%q\n%q", b.String(), expected)
+	}
+
+	spans := []Span{
+		{Style{Foreground: Red}, "1st"},
+		{Style{Foreground: Red, Background: Blue}, ",2nd"},
+		{Style{Foreground: Green, Background: Blue}, " green"},
+		{Style{Foreground: Green}, " no bg"},
+		{Style{Foreground: Green, Bold: true}, " bold"},
+		{Style{Foreground: RGB(0xAB, 0xCD, 0xEF), Bold: true}, "cafe"},
+		{Style{}, " plain"},
+	}
+	if parsed := Parse(b.String()); !reflect.DeepEqual(parsed, spans) {
+		t.Errorf("Builder output parsed as %+v", parsed)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for i, test := range parseTests {
+		if spans := Parse(Format(test.spans)); !reflect.DeepEqual(spans, test.spans) {
+			t.Errorf("Failed to format %d: got %+v", i, spans)
+		}
+	}
+
+	// Hex colours can't keep the default text colour.
+	spans := []Span{{Style{Background: RGB(1, 2, 3)}, "x"}, {Style{Underline: true}, "y"}}
+	if text := Format(spans); text != "\x04000000,010203x\x1F\x03y" {
+		t.Errorf("Wrong output %q", text)
+	}
+}
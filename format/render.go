@@ -0,0 +1,155 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package format
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// ANSI terminal colours for the 16 basic mIRC colours. Background colours
+// are 10 higher.
+var ansiColors = [16]int{97, 30, 34, 32, 91, 31, 35, 33, 93, 92, 36, 96, 94, 95, 90, 37}
+
+// ANSI returns text with its formatting converted to ANSI terminal escape
+// sequences. The 16 basic colours use the standard terminal colours, other
+// colours are written as 24-bit colours. Monospace is ignored.
+//
+// Control characters other than tabs are removed from the text, so text
+// from others can't send escape sequences to the terminal.
+func ANSI(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+
+	styled := false
+	for _, span := range Parse(text) {
+		if !span.IsPlain() || styled {
+			b.WriteString(ansiStyle(span.Style))
+			styled = !span.IsPlain()
+		}
+		writeSanitized(&b, span.Text)
+	}
+
+	if styled {
+		b.WriteString(ansiStyle(Style{}))
+	}
+
+	return b.String()
+}
+
+// ansiStyle returns the escape sequence that sets style s, resetting
+// previous formatting first.
+func ansiStyle(s Style) string {
+	codes := []string{"0"}
+
+	if s.Bold {
+		codes = append(codes, "1")
+	}
+	if s.Italic {
+		codes = append(codes, "3")
+	}
+	if s.Underline {
+		codes = append(codes, "4")
+	}
+	if s.Reverse {
+		codes = append(codes, "7")
+	}
+	if s.Strikethrough {
+		codes = append(codes, "9")
+	}
+	if !s.Foreground.IsDefault() {
+		codes = append(codes, ansiColor(s.Foreground, 0, "38"))
+	}
+	if !s.Background.IsDefault() {
+		codes = append(codes, ansiColor(s.Background, 10, "48"))
+	}
+
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// ansiColor returns the SGR parameters for colour c. Basic colours are
+// offset by offset, others use the 24-bit colour parameter extended.
+func ansiColor(c Color, offset int, extended string) string {
+	if n, ok := c.Index(); ok && n < len(ansiColors) {
+		return strconv.Itoa(ansiColors[n] + offset)
+	}
+	r, g, b := c.RGB()
+	return extended + ";2;" + strconv.Itoa(int(r)) + ";" + strconv.Itoa(int(g)) + ";" + strconv.Itoa(int(b))
+}
+
+// HTML returns text as HTML, with formatted text in span elements using
+// inline styles. The text is escaped and control characters other than tabs
+// are removed, so the result is safe to include in a page.
+//
+// Reverse swaps the colours, and is ignored if neither colour is set.
+func HTML(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+
+	for _, span := range Parse(text) {
+		css := htmlStyle(span.Style)
+		if len(css) > 0 {
+			b.WriteString(`<span style="`)
+			b.WriteString(css)
+			b.WriteString(`">`)
+		}
+
+		var s strings.Builder
+		writeSanitized(&s, span.Text)
+		b.WriteString(html.EscapeString(s.String()))
+
+		if len(css) > 0 {
+			b.WriteString("</span>")
+		}
+	}
+
+	return b.String()
+}
+
+// htmlStyle returns the CSS declarations for style s.
+func htmlStyle(s Style) string {
+	var css []string
+
+	if s.Bold {
+		css = append(css, "font-weight:bold")
+	}
+	if s.Italic {
+		css = append(css, "font-style:italic")
+	}
+	if s.Underline && s.Strikethrough {
+		css = append(css, "text-decoration:underline line-through")
+	} else if s.Underline {
+		css = append(css, "text-decoration:underline")
+	} else if s.Strikethrough {
+		css = append(css, "text-decoration:line-through")
+	}
+	if s.Monospace {
+		css = append(css, "font-family:monospace")
+	}
+
+	fg, bg := s.Foreground, s.Background
+	if s.Reverse {
+		fg, bg = bg, fg
+	}
+	if !fg.IsDefault() {
+		css = append(css, "color:"+fg.Hex())
+	}
+	if !bg.IsDefault() {
+		css = append(css, "background-color:"+bg.Hex())
+	}
+
+	return strings.Join(css, ";")
+}
+
+// writeSanitized writes text to b without control characters, except tabs.
+func writeSanitized(b *strings.Builder, text string) {
+	for _, r := range text {
+		if (r < 0x20 && r != '\t') || r == 0x7F || (r >= 0x80 && r < 0xA0) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+}
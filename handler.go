@@ -0,0 +1,256 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Various constants used for handler patterns.
+const (
+	patternAny   = "*" // Matches every command.
+	patternRange = "-" // Separates the bounds of a numeric range.
+)
+
+// A Handler responds to an IRC message.
+//
+// Handlers should not modify the message, it is shared with other handlers.
+type Handler interface {
+	ServeIRC(w *ReplyWriter, m *Message)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary functions
+// as IRC handlers.
+type HandlerFunc func(w *ReplyWriter, m *Message)
+
+// ServeIRC calls f(w, m).
+func (f HandlerFunc) ServeIRC(w *ReplyWriter, m *Message) {
+	f(w, m)
+}
+
+// Middleware wraps a Handler to run code before or after it.
+type Middleware func(Handler) Handler
+
+// Chain wraps h with given middleware. The first middleware is the outermost
+// and thus runs first.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Async returns a handler that runs h in a new goroutine for every message.
+//
+// Messages are delivered in order by default, so a slow handler delays all
+// other handlers. Async handlers don't, but may see messages out of order.
+func Async(h Handler) Handler {
+	return HandlerFunc(func(w *ReplyWriter, m *Message) {
+		go h.ServeIRC(w, m)
+	})
+}
+
+// A ReplyWriter is used by a Handler to send messages.
+//
+// The embedded Encoder may be used to send arbitrary messages.
+type ReplyWriter struct {
+	*Encoder
+
+	message  *Message
+	isupport *ISupport
+}
+
+// NewReplyWriter returns a ReplyWriter for message m that writes to enc.
+// The ISupport is used to recognize channels and may be nil.
+func NewReplyWriter(enc *Encoder, m *Message, isupport *ISupport) *ReplyWriter {
+	if isupport == nil {
+		isupport = NewISupport()
+	}
+	return &ReplyWriter{
+		Encoder:  enc,
+		message:  m,
+		isupport: isupport,
+	}
+}
+
+// ISupport returns the features advertised by the server so far.
+func (w *ReplyWriter) ISupport() *ISupport {
+	return w.isupport
+}
+
+// Target returns where replies to the message should go: the channel if it
+// was sent to a channel, the sender otherwise.
+func (w *ReplyWriter) Target() string {
+	if len(w.message.Params) > 0 && w.isupport.IsChannel(w.message.Params[0]) {
+		return w.message.Params[0]
+	}
+	if w.message.Prefix != nil {
+		return w.message.Prefix.Name
+	}
+	return ""
+}
+
+// Reply sends text to Target using a PRIVMSG.
+func (w *ReplyWriter) Reply(text string) error {
+	return w.reply(PRIVMSG, text)
+}
+
+// Notice sends text to Target using a NOTICE.
+func (w *ReplyWriter) Notice(text string) error {
+	return w.reply(NOTICE, text)
+}
+
+func (w *ReplyWriter) reply(command, text string) error {
+	return w.Encode(&Message{
+		Command:  command,
+		Params:   []string{w.Target()},
+		Trailing: text,
+	})
+}
+
+// muxEntry is a single handler registered with a ServeMux.
+type muxEntry struct {
+	command  string // Exact command, empty for ranges and wildcards.
+	min, max int    // Numeric range, inclusive.
+	any      bool
+	handler  Handler
+}
+
+// match returns true if the entry should handle given command.
+func (e *muxEntry) match(command string) bool {
+	switch {
+	case e.any:
+		return true
+	case len(e.command) > 0:
+		return e.command == command
+	}
+	n, ok := numeric(command)
+	return ok && n >= e.min && n <= e.max
+}
+
+// numeric returns the value of a three digit numeric reply.
+func numeric(command string) (n int, ok bool) {
+	if len(command) != 3 {
+		return 0, false
+	}
+	for i := 0; i < len(command); i++ {
+		if command[i] < '0' || command[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(command[i]-'0')
+	}
+	return n, true
+}
+
+// ServeMux is an IRC message multiplexer.
+//
+// Patterns are commands ("PRIVMSG", "001"), inclusive numeric ranges
+// ("400-599") or "*" to match every message. Commands are case insensitive.
+//
+// Unlike its net/http counterpart, ServeMux calls every handler with a
+// matching pattern, in the order they were registered.
+type ServeMux struct {
+	entries    []*muxEntry
+	middleware []Middleware
+	mu         sync.RWMutex
+}
+
+// NewServeMux allocates and returns a new ServeMux.
+func NewServeMux() *ServeMux {
+	return new(ServeMux)
+}
+
+// Handle registers the handler for given pattern.
+//
+// Panics if the pattern is invalid.
+func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	entry := &muxEntry{handler: handler}
+
+	i := strings.Index(pattern, patternRange)
+	if i > 0 {
+		var ok1, ok2 bool
+		entry.min, ok1 = numeric(pattern[:i])
+		entry.max, ok2 = numeric(pattern[i+1:])
+		if !ok1 || !ok2 || entry.min > entry.max {
+			panic("irc: invalid pattern " + strconv.Quote(pattern))
+		}
+	}
+
+	switch {
+	case pattern == patternAny:
+		entry.any = true
+	case i > 0:
+		// Numeric range, parsed above.
+	case len(pattern) > 0 && indexAny(pattern, " \r\n\x00") < 0:
+		entry.command = strings.ToUpper(pattern)
+	default:
+		panic("irc: invalid pattern " + strconv.Quote(pattern))
+	}
+
+	if handler == nil {
+		panic("irc: nil handler")
+	}
+
+	mux.mu.Lock()
+	mux.entries = append(mux.entries, entry)
+	mux.mu.Unlock()
+}
+
+// HandleFunc registers the handler function for given pattern.
+func (mux *ServeMux) HandleFunc(pattern string, handler func(w *ReplyWriter, m *Message)) {
+	mux.Handle(pattern, HandlerFunc(handler))
+}
+
+// Use adds middleware that wraps every handler of the ServeMux. Middleware
+// runs once for each matching handler.
+func (mux *ServeMux) Use(middleware ...Middleware) {
+	mux.mu.Lock()
+	mux.middleware = append(mux.middleware, middleware...)
+	mux.mu.Unlock()
+}
+
+// ServeIRC dispatches the message to every handler whose pattern matches
+// its command.
+func (mux *ServeMux) ServeIRC(w *ReplyWriter, m *Message) {
+	command := strings.ToUpper(m.Command)
+
+	mux.mu.RLock()
+	entries, middleware := mux.entries, mux.middleware
+	mux.mu.RUnlock()
+
+	for _, entry := range entries {
+		if entry.match(command) {
+			Chain(entry.handler, middleware...).ServeIRC(w, m)
+		}
+	}
+}
+
+// Serve reads messages from c and calls handler for each of them, in order.
+// RPL_ISUPPORT messages are tracked for ReplyWriter.ISupport.
+//
+// Messages that can't be parsed are skipped. Serve returns when decoding
+// fails, io.EOF if the server closed the connection.
+func Serve(c *Conn, handler Handler) error {
+	isupport := NewISupport()
+
+	for {
+		m, err := c.Decode()
+
+		if _, ok := err.(*ParseError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			continue
+		}
+
+		isupport.Update(m)
+		handler.ServeIRC(NewReplyWriter(&c.Encoder, m, isupport), m)
+	}
+}
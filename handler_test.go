@@ -0,0 +1,138 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServeMux(t *testing.T) {
+	var called []string
+
+	record := func(name string) HandlerFunc {
+		return func(w *ReplyWriter, m *Message) {
+			called = append(called, name+":"+m.Command)
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Handle("privmsg", record("privmsg"))
+	mux.Handle("400-599", record("errors"))
+	mux.Handle("*", record("any"))
+	mux.Handle("001", record("welcome"))
+
+	for _, raw := range []string{"PRIVMSG #go :hi", "433 * bot :In use", "001 bot :Welcome", "PING :x", "600 bot :x"} {
+		mux.ServeIRC(NewReplyWriter(NewEncoder(new(bytes.Buffer)), ParseMessage(raw), nil), ParseMessage(raw))
+	}
+
+	expected := []string{
+		"privmsg:PRIVMSG", "any:PRIVMSG",
+		"errors:433", "any:433",
+		"any:001", "welcome:001",
+		"any:PING",
+		"any:600",
+	}
+
+	if !reflect.DeepEqual(called, expected) {
+		t.Errorf("Handlers called in wrong order: %q", called)
+	}
+}
+
+func TestServeMux_invalidPattern(t *testing.T) {
+	for _, pattern := range []string{"", "500-400", "1-2", "PRIV MSG"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Pattern %q should panic", pattern)
+				}
+			}()
+			NewServeMux().HandleFunc(pattern, func(w *ReplyWriter, m *Message) {})
+		}()
+	}
+}
+
+func TestServeMux_Use(t *testing.T) {
+	var called []string
+
+	trace := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(w *ReplyWriter, m *Message) {
+				called = append(called, name)
+				h.ServeIRC(w, m)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Use(trace("first"), trace("second"))
+	mux.HandleFunc(PING, func(w *ReplyWriter, m *Message) {
+		called = append(called, "handler")
+	})
+
+	m := ParseMessage("PING :x")
+	mux.ServeIRC(NewReplyWriter(NewEncoder(new(bytes.Buffer)), m, nil), m)
+
+	if expected := []string{"first", "second", "handler"}; !reflect.DeepEqual(called, expected) {
+		t.Errorf("Middleware called in wrong order: %q", called)
+	}
+}
+
+func TestReplyWriter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+
+	isupport := NewISupport()
+	isupport.Add("CHANTYPES=#")
+
+	for _, raw := range []string{":alice!a@host PRIVMSG #go :hi", ":alice!a@host PRIVMSG bot :hi", ":alice!a@host PRIVMSG &local :hi"} {
+		NewReplyWriter(enc, ParseMessage(raw), isupport).Reply("hello")
+	}
+	NewReplyWriter(enc, ParseMessage(":alice!a@host PRIVMSG bot :hi"), nil).Notice("hello")
+
+	expected := "PRIVMSG #go :hello\r\nPRIVMSG alice :hello\r\nPRIVMSG alice :hello\r\nNOTICE alice :hello\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Wrong replies: %q", buffer.String())
+	}
+}
+
+// readWriter joins a reader and writer into an io.ReadWriteCloser.
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+func (readWriter) Close() error {
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	input := strings.NewReader(strings.Join([]string{
+		":irc.test 005 bot CHANTYPES=! :are supported by this server",
+		"bogus\x00message",
+		":alice!a@host PRIVMSG !chan :!ping",
+		"",
+	}, "\r\n"))
+	output := new(bytes.Buffer)
+
+	mux := NewServeMux()
+	mux.HandleFunc(PRIVMSG, func(w *ReplyWriter, m *Message) {
+		if m.Trailing == "!ping" {
+			w.Reply("pong")
+		}
+	})
+
+	if err := Serve(NewConn(readWriter{input, output}), mux); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+
+	if output.String() != "PRIVMSG !chan :pong\r\n" {
+		t.Errorf("Wrong output: %q", output.String())
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default values for tokens missing from RPL_ISUPPORT, mostly from RFC1459
+// and RFC2812.
+const (
+	defaultChanTypes   = "#&"
+	defaultPrefix      = "(ov)@+"
+	defaultChanModes   = "b,k,l,imnpst"
+	defaultCaseMapping = "rfc1459"
+	defaultNickLen     = 9
+	defaultChannelLen  = 200
+	defaultModes       = 3
+	defaultLineLen     = maxLength + 2
+)
+
+// ChanModes describes which channel modes take a parameter.
+// See https://modern.ircdocs.horse/#chanmodes-parameter
+type ChanModes struct {
+	List    string // Type A: modes that add or remove an address from a list, always take a parameter
+	Always  string // Type B: modes that always take a parameter
+	SetOnly string // Type C: modes that take a parameter only when set
+	Never   string // Type D: modes that never take a parameter
+	Prefix  string // Membership modes from PREFIX, such as o and v, always take a parameter
+}
+
+// ISupport holds the features a server advertises using RPL_ISUPPORT (005).
+// See https://modern.ircdocs.horse/#rplisupport-005
+//
+// Getters return the RFC defaults for tokens the server did not send.
+// All methods may be used from multiple goroutines.
+type ISupport struct {
+	tokens map[string]string
+	mu     sync.RWMutex
+}
+
+// NewISupport returns an ISupport without any tokens.
+func NewISupport() *ISupport {
+	return &ISupport{
+		tokens: make(map[string]string),
+	}
+}
+
+// Update adds the tokens from an RPL_ISUPPORT message.
+// Returns false if m is not an RPL_ISUPPORT message.
+func (s *ISupport) Update(m *Message) bool {
+	if m.Command != RPL_ISUPPORT || len(m.Params) < 2 {
+		return false
+	}
+	s.Add(m.Params[1:]...)
+	return true
+}
+
+// Add adds tokens in "NAME", "NAME=value" or "-NAME" notation. Tokens
+// starting with '-' remove a previously advertised token.
+func (s *ISupport) Add(tokens ...string) {
+	s.mu.Lock()
+	for _, token := range tokens {
+		if len(token) <= 0 {
+			continue
+		}
+		if token[0] == '-' {
+			delete(s.tokens, token[1:])
+			continue
+		}
+		name, value := token, ""
+		if i := indexByte(token, '='); i >= 0 {
+			name, value = token[:i], unescapeISupport(token[i+1:])
+		}
+		s.tokens[name] = value
+	}
+	s.mu.Unlock()
+}
+
+// Get returns the value of a token. The ok value is false if the server did
+// not advertise the token.
+func (s *ISupport) Get(name string) (value string, ok bool) {
+	s.mu.RLock()
+	value, ok = s.tokens[name]
+	s.mu.RUnlock()
+	return
+}
+
+// Has returns true if the server advertised the token.
+func (s *ISupport) Has(name string) bool {
+	_, ok := s.Get(name)
+	return ok
+}
+
+// getDefault returns the value of a token, or def if the token is missing or
+// has no value.
+func (s *ISupport) getDefault(name, def string) string {
+	if value, ok := s.Get(name); ok && len(value) > 0 {
+		return value
+	}
+	return def
+}
+
+// getInt returns the integer value of a token, or def if the token is
+// missing or not a number.
+func (s *ISupport) getInt(name string, def int) int {
+	if n, err := strconv.Atoi(s.getDefault(name, "")); err == nil {
+		return n
+	}
+	return def
+}
+
+// ChanTypes returns the channel prefixes from CHANTYPES, "#&" by default.
+func (s *ISupport) ChanTypes() string {
+	if value, ok := s.Get("CHANTYPES"); ok {
+		return value
+	}
+	return defaultChanTypes
+}
+
+// IsChannel returns true if name starts with one of the ChanTypes.
+func (s *ISupport) IsChannel(name string) bool {
+	return len(name) > 0 && indexByte(s.ChanTypes(), name[0]) >= 0
+}
+
+// Prefix returns the membership modes and their symbols from PREFIX, in order
+// of rank. By default, modes is "ov" and symbols is "@+".
+func (s *ISupport) Prefix() (modes, symbols string) {
+	value, ok := s.Get("PREFIX")
+	if !ok {
+		value = defaultPrefix
+	}
+	i := indexByte(value, ')')
+	if len(value) <= 0 || value[0] != '(' || i < 0 || len(value)-i-1 != i-1 {
+		return "", ""
+	}
+	return value[1:i], value[i+1:]
+}
+
+// PrefixSymbol returns the symbol for a membership mode, such as '@' for 'o'.
+func (s *ISupport) PrefixSymbol(mode byte) (symbol byte, ok bool) {
+	modes, symbols := s.Prefix()
+	if i := indexByte(modes, mode); i >= 0 {
+		return symbols[i], true
+	}
+	return 0, false
+}
+
+// PrefixMode returns the membership mode for a symbol, such as 'o' for '@'.
+func (s *ISupport) PrefixMode(symbol byte) (mode byte, ok bool) {
+	modes, symbols := s.Prefix()
+	if i := indexByte(symbols, symbol); i >= 0 {
+		return modes[i], true
+	}
+	return 0, false
+}
+
+// ChanModes returns the channel mode classes from CHANMODES and PREFIX.
+// By default, ban lists (b), keys (k) and limits (l) take parameters.
+func (s *ISupport) ChanModes() (c ChanModes) {
+	classes := strings.Split(s.getDefault("CHANMODES", defaultChanModes), ",")
+	for len(classes) < 4 {
+		classes = append(classes, "")
+	}
+	c.List, c.Always, c.SetOnly, c.Never = classes[0], classes[1], classes[2], classes[3]
+	c.Prefix, _ = s.Prefix()
+	return c
+}
+
+// CaseMapping returns the name of the casemapping from CASEMAPPING,
+// "rfc1459" by default.
+func (s *ISupport) CaseMapping() string {
+	return s.getDefault("CASEMAPPING", defaultCaseMapping)
+}
+
+// NickLen returns the maximum nickname length from NICKLEN, 9 by default.
+func (s *ISupport) NickLen() int {
+	return s.getInt("NICKLEN", defaultNickLen)
+}
+
+// ChannelLen returns the maximum channel name length from CHANNELLEN,
+// 200 by default.
+func (s *ISupport) ChannelLen() int {
+	return s.getInt("CHANNELLEN", defaultChannelLen)
+}
+
+// Modes returns the maximum number of modes with a parameter in a single
+// MODE command from MODES, 3 by default. Zero means there is no limit.
+func (s *ISupport) Modes() int {
+	if value, ok := s.Get("MODES"); ok && len(value) <= 0 {
+		return 0
+	}
+	return s.getInt("MODES", defaultModes)
+}
+
+// LineLen returns the maximum line length including CR LF, from LINELEN.
+// By default, this is 512.
+func (s *ISupport) LineLen() int {
+	return s.getInt("LINELEN", defaultLineLen)
+}
+
+// Network returns the network name from NETWORK.
+func (s *ISupport) Network() string {
+	value, _ := s.Get("NETWORK")
+	return value
+}
+
+// Monitor returns the maximum number of MONITOR targets. The ok value is
+// false if the server does not support MONITOR, a zero limit with ok set to
+// true means there is no limit.
+func (s *ISupport) Monitor() (limit int, ok bool) {
+	if _, ok = s.Get("MONITOR"); ok {
+		limit = s.getInt("MONITOR", 0)
+	}
+	return
+}
+
+// TargMax returns the maximum number of targets for a command, from TARGMAX.
+// The ok value is false if the server did not specify a limit for command,
+// a zero limit with ok set to true means there is no limit.
+func (s *ISupport) TargMax(command string) (limit int, ok bool) {
+	value, _ := s.Get("TARGMAX")
+	for _, item := range strings.Split(value, ",") {
+		i := indexByte(item, ':')
+		if i < 0 || !strings.EqualFold(item[:i], command) {
+			continue
+		}
+		if n, err := strconv.Atoi(item[i+1:]); err == nil {
+			return n, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// unescapeISupport replaces \xHH escapes in token values.
+func unescapeISupport(value string) string {
+
+	// Fast path, nothing to unescape.
+	if !strings.Contains(value, "\\x") {
+		return value
+	}
+
+	b := make([]byte, 0, len(value))
+
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if n, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				b = append(b, byte(n))
+				i = i + 3
+				continue
+			}
+		}
+		b = append(b, value[i])
+	}
+
+	return string(b)
+}
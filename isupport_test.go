@@ -0,0 +1,86 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestISupport_defaults(t *testing.T) {
+	s := NewISupport()
+
+	if s.ChanTypes() != "#&" || s.CaseMapping() != "rfc1459" || s.NickLen() != 9 || s.Modes() != 3 || s.LineLen() != 512 {
+		t.Error("Missing tokens should use RFC defaults.")
+	}
+	if modes, symbols := s.Prefix(); modes != "ov" || symbols != "@+" {
+		t.Errorf("Wrong default prefix: %s %s", modes, symbols)
+	}
+	if c := s.ChanModes(); c != (ChanModes{"b", "k", "l", "imnpst", "ov"}) {
+		t.Errorf("Wrong default channel modes: %#v", c)
+	}
+	if _, ok := s.Monitor(); ok {
+		t.Error("MONITOR should not be supported by default.")
+	}
+}
+
+func TestISupport_Update(t *testing.T) {
+	s := NewISupport()
+
+	messages := []string{
+		":irc.test 005 bot CHANTYPES=# PREFIX=(qaohv)~&@%+ CHANMODES=beI,k,l,imnpst NETWORK=Example\\x20Net :are supported by this server",
+		":irc.test 005 bot CASEMAPPING=ascii NICKLEN=30 MODES TARGMAX=PRIVMSG:4,NOTICE:4,JOIN: MONITOR=100 EXCEPTS :are supported by this server",
+		":irc.test 005 bot -EXCEPTS :are supported by this server",
+	}
+
+	for _, raw := range messages {
+		if !s.Update(ParseMessage(raw)) {
+			t.Fatalf("Failed to update from %q", raw)
+		}
+	}
+
+	if s.Update(ParseMessage(":irc.test 001 bot :Welcome")) {
+		t.Error("Update should ignore other messages.")
+	}
+
+	if s.ChanTypes() != "#" || !s.IsChannel("#test") || s.IsChannel("&test") {
+		t.Errorf("Wrong channel types: %s", s.ChanTypes())
+	}
+	if s.Network() != "Example Net" {
+		t.Errorf("Wrong network name: %q", s.Network())
+	}
+	if s.CaseMapping() != "ascii" || s.NickLen() != 30 || s.Modes() != 0 {
+		t.Error("Wrong values for CASEMAPPING, NICKLEN or MODES")
+	}
+	if s.Has("EXCEPTS") {
+		t.Error("Negated tokens should be removed.")
+	}
+
+	if symbol, ok := s.PrefixSymbol('h'); !ok || symbol != '%' {
+		t.Errorf("Wrong symbol for h: %c", symbol)
+	}
+	if mode, ok := s.PrefixMode('~'); !ok || mode != 'q' {
+		t.Errorf("Wrong mode for ~: %c", mode)
+	}
+	if _, ok := s.PrefixMode('!'); ok {
+		t.Error("Unknown symbols should not have a mode.")
+	}
+
+	if c := s.ChanModes(); c != (ChanModes{"beI", "k", "l", "imnpst", "qaohv"}) {
+		t.Errorf("Wrong channel modes: %#v", c)
+	}
+
+	if limit, ok := s.TargMax("privmsg"); !ok || limit != 4 {
+		t.Errorf("Wrong PRIVMSG target limit: %d", limit)
+	}
+	if limit, ok := s.TargMax("JOIN"); !ok || limit != 0 {
+		t.Errorf("Wrong JOIN target limit: %d", limit)
+	}
+	if _, ok := s.TargMax("KICK"); ok {
+		t.Error("KICK should not have a target limit.")
+	}
+	if limit, ok := s.Monitor(); !ok || limit != 100 {
+		t.Errorf("Wrong MONITOR limit: %d", limit)
+	}
+}
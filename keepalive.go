@@ -0,0 +1,203 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults used for keepalive settings that are not set.
+const (
+	keepaliveInterval = 2 * time.Minute
+	keepaliveToken    = "keepalive-"
+)
+
+// TimeoutError is returned by Decode after the keepalive closed the
+// connection because the server did not answer a PING in time.
+type TimeoutError struct {
+	Window time.Duration // How long the keepalive waited for a PONG
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("irc: no PONG received within %s", e.Window)
+}
+
+// Timeout returns true, so TimeoutError implements net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary returns false, the connection is closed.
+func (e *TimeoutError) Temporary() bool {
+	return false
+}
+
+// KeepaliveConfig contains the settings for Conn.StartKeepalive.
+type KeepaliveConfig struct {
+	// Time between client PINGs, 2 minutes if zero.
+	Interval time.Duration
+
+	// How long to wait for a PONG before closing the connection, equal to
+	// Interval if zero.
+	Timeout time.Duration
+}
+
+// keepalive holds the state of a running keepalive.
+type keepalive struct {
+	config  KeepaliveConfig
+	counter int
+	token   string // Token of the PING waiting for a PONG, empty if none.
+	sent    time.Time
+	timer   *time.Timer
+	lag     time.Duration
+	err     error
+	stop    chan struct{}
+	mu      sync.Mutex
+}
+
+// StartKeepalive enables the keepalive on this connection.
+//
+// Decode answers server PINGs automatically, the PING is still returned.
+// Every Interval a PING with a unique token is sent to the server, the time
+// until its PONG arrives is available from Lag. If no PONG arrives within
+// Timeout, the connection is closed and Decode returns a *TimeoutError.
+//
+// The keepalive relies on Decode being called to process PONG replies and
+// stops when the connection is closed. Calling StartKeepalive again replaces
+// the previous settings.
+func (c *Conn) StartKeepalive(config KeepaliveConfig) {
+	if config.Interval <= 0 {
+		config.Interval = keepaliveInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = config.Interval
+	}
+
+	k := &keepalive{
+		config: config,
+		stop:   make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	if c.keepalive != nil {
+		c.keepalive.close()
+	}
+	c.keepalive = k
+	c.mu.Unlock()
+
+	go k.run(c)
+}
+
+// Lag returns the round-trip time of the last keepalive PING, or zero if
+// none was answered yet.
+func (c *Conn) Lag() time.Duration {
+	if k := c.getKeepalive(); k != nil {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		return k.lag
+	}
+	return 0
+}
+
+// getKeepalive returns the running keepalive, or nil if it is disabled.
+func (c *Conn) getKeepalive() *keepalive {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keepalive
+}
+
+// run sends a PING every interval until the keepalive is stopped.
+func (k *keepalive) run(c *Conn) {
+	ticker := time.NewTicker(k.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+		}
+
+		k.mu.Lock()
+		if len(k.token) > 0 {
+			// Still waiting for the previous PONG.
+			k.mu.Unlock()
+			continue
+		}
+		k.counter++
+		token := keepaliveToken + strconv.Itoa(k.counter)
+		k.token, k.sent = token, time.Now()
+		k.timer = time.AfterFunc(k.config.Timeout, func() {
+			k.expire(c, token)
+		})
+		k.mu.Unlock()
+
+		c.Encode(&Message{Command: PING, Trailing: token})
+	}
+}
+
+// expire closes the connection if the PING with given token is unanswered.
+func (k *keepalive) expire(c *Conn, token string) {
+	k.mu.Lock()
+	if k.token != token {
+		k.mu.Unlock()
+		return
+	}
+	k.err = &TimeoutError{k.config.Timeout}
+	k.mu.Unlock()
+
+	c.Close()
+}
+
+// handle answers PING and processes PONG messages.
+func (k *keepalive) handle(c *Conn, m *Message) {
+	switch m.Command {
+	case PING:
+		c.Encode(&Message{Command: PONG, Params: m.Params, Trailing: m.Trailing, EmptyTrailing: m.EmptyTrailing})
+
+	case PONG:
+		token := m.Trailing
+		if len(token) <= 0 && len(m.Params) > 0 {
+			token = m.Params[len(m.Params)-1]
+		}
+
+		k.mu.Lock()
+		if len(k.token) > 0 && token == k.token {
+			k.timer.Stop()
+			k.lag = time.Since(k.sent)
+			k.token = ""
+		}
+		k.mu.Unlock()
+	}
+}
+
+// error returns the error that made the keepalive close the connection.
+func (k *keepalive) error() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+// close stops the keepalive.
+func (k *keepalive) close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	select {
+	case <-k.stop:
+		return
+	default:
+	}
+
+	close(k.stop)
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+	// Make sure a pending PING can't expire anymore.
+	k.token = ""
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConn_StartKeepalive(t *testing.T) {
+	var received []string
+
+	c, done := testServer(t, func(m *Message, enc *Encoder) {
+		received = append(received, m.String())
+
+		switch m.Command {
+		case NICK:
+			send(enc, "PING :12345")
+		case PING:
+			send(enc, ":irc.test PONG irc.test :"+m.Trailing)
+		}
+	})
+
+	c.StartKeepalive(KeepaliveConfig{Interval: 50 * time.Millisecond})
+	c.Encode(&Message{Command: NICK, Params: []string{"bot"}})
+
+	for pongs := 0; pongs < 2; {
+		m, err := c.Decode()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if m.Command == PONG {
+			pongs++
+		}
+	}
+
+	if c.Lag() <= 0 {
+		t.Errorf("Lag should be measured, got %s", c.Lag())
+	}
+
+	c.Close()
+	<-done
+
+	expected := []string{"NICK bot", "PONG :12345", "PING :keepalive-1", "PING :keepalive-2"}
+
+	if len(received) < len(expected) {
+		t.Fatalf("Client sent unexpected messages: %q", received)
+	}
+	for i, raw := range expected {
+		if received[i] != raw {
+			t.Errorf("Client sent unexpected messages: %q", received)
+			break
+		}
+	}
+}
+
+func TestConn_StartKeepalive_timeout(t *testing.T) {
+	c, _ := testServer(t, func(m *Message, enc *Encoder) {})
+	defer c.Close()
+
+	c.StartKeepalive(KeepaliveConfig{Interval: 10 * time.Millisecond, Timeout: 20 * time.Millisecond})
+
+	_, err := c.Decode()
+
+	if terr, ok := err.(*TimeoutError); !ok || terr.Window != 20*time.Millisecond || !terr.Timeout() {
+		t.Errorf("Expected *TimeoutError, got %v", err)
+	}
+}
@@ -150,7 +150,12 @@ func (p *Prefix) writeTo(buffer *bytes.Buffer) {
 //                   NUL or CR or LF>
 //
 //    <crlf>     ::= CR LF
+//
+// Messages may start with an IRCv3 tags section, see Tags.
+//
+//    <message>  ::= ['@' <tags> <SPACE>] [':' <prefix> <SPACE> ] <command> <params> <crlf>
 type Message struct {
+	Tags Tags
 	*Prefix
 	Command  string
 	Params   []string
@@ -173,6 +178,24 @@ func ParseMessage(raw string) (m *Message) {
 
 	m = new(Message)
 
+	if raw[0] == tagPrefix {
+
+		// Tags end with a space.
+		i = indexByte(raw, space)
+
+		// Tags must be followed by a command.
+		if i < 2 {
+			return nil
+		}
+
+		m.Tags = ParseTags(raw[1:i])
+
+		// Skip the tags and the space following them.
+		if raw, i = raw[i+1:], 0; len(raw) < 2 {
+			return nil
+		}
+	}
+
 	if raw[0] == prefix {
 
 		// Prefix ends with a space.
@@ -239,8 +262,10 @@ func ParseMessage(raw string) (m *Message) {
 // Len calculates the length of the string representation of this message.
 func (m *Message) Len() (length int) {
 
+	length = m.tagsLen()
+
 	if m.Prefix != nil {
-		length = m.Prefix.Len() + 2 // Include prefix and trailing space
+		length = length + m.Prefix.Len() + 2 // Include prefix and trailing space
 	}
 
 	length = length + len(m.Command)
@@ -259,15 +284,44 @@ func (m *Message) Len() (length int) {
 	return
 }
 
+// tagsLen returns the length of the tags section written by Bytes, including
+// the tag indicator and trailing space. Tags exceeding the limit are not
+// counted, as Bytes discards them.
+func (m *Message) tagsLen() int {
+	if n := m.Tags.fit(maxTagLength - 2); n > 0 {
+		return m.Tags[:n].Len() + 2
+	}
+	return 0
+}
+
 // Bytes returns a []byte representation of this message.
 //
 // As noted in rfc2812 section 2.3, messages should not exceed 512 characters
 // in length. This method forces that limit by discarding any characters
-// exceeding the length limit.
+// exceeding the length limit. UTF-8 encoded runes are never cut in half.
+//
+// The tags section has a separate budget of 8191 bytes, as defined in the
+// IRCv3 message-tags specification. Tags that don't fit are discarded.
 func (m *Message) Bytes() []byte {
 
 	buffer := new(bytes.Buffer)
 
+	// Message tags
+	if len(m.Tags) > 0 {
+		buffer.WriteByte(tagPrefix)
+		m.Tags.writeTo(buffer, maxTagLength-2)
+
+		// Don't leave an empty tags section if no tag could be written.
+		if buffer.Len() > 1 {
+			buffer.WriteByte(space)
+		} else {
+			buffer.Reset()
+		}
+	}
+
+	// The length limit only applies to the message after the tags.
+	start := buffer.Len()
+
 	// Message prefix
 	if m.Prefix != nil {
 		buffer.WriteByte(prefix)
@@ -290,9 +344,9 @@ func (m *Message) Bytes() []byte {
 		buffer.WriteString(m.Trailing)
 	}
 
-	// We need the limit the buffer length.
-	if buffer.Len() > (maxLength) {
-		buffer.Truncate(maxLength)
+	// We need the limit the buffer length, without cutting a rune in half.
+	if buffer.Len()-start > (maxLength) {
+		buffer.Truncate(start + runeBoundary(string(buffer.Bytes()[start:]), maxLength))
 	}
 
 	return buffer.Bytes()
@@ -306,3 +360,31 @@ func (m *Message) Bytes() []byte {
 func (m *Message) String() string {
 	return string(m.Bytes())
 }
+
+// TruncateTrailing shortens the trailing parameter to at most maxBytes bytes,
+// without cutting a UTF-8 encoded rune in half.
+//
+// Returns true if the trailing parameter was shortened.
+func (m *Message) TruncateTrailing(maxBytes int) bool {
+	return m.TruncateTrailingEllipsis(maxBytes, "")
+}
+
+// TruncateTrailingEllipsis works like TruncateTrailing, but ends shortened
+// text with ellipsis. The ellipsis is included in maxBytes.
+func (m *Message) TruncateTrailingEllipsis(maxBytes int, ellipsis string) bool {
+
+	if len(m.Trailing) <= maxBytes {
+		return false
+	}
+
+	if maxBytes < len(ellipsis) {
+		ellipsis = ""
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+
+	m.Trailing = m.Trailing[:runeBoundary(m.Trailing, maxBytes-len(ellipsis))] + ellipsis
+
+	return true
+}
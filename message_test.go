@@ -7,7 +7,9 @@ package irc
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func ExampleParseMessage() {
@@ -302,6 +304,39 @@ var messageTests = [...]*struct {
 		rawMessage: "PASS oauth:token_goes_here",
 		rawPrefix:  "",
 	},
+	{
+		parsed: &Message{
+			Tags: Tags{
+				{Key: "time", Value: "2011-10-19T16:40:51.620Z"},
+				{Key: "msgid", Value: "63E1033A051D4B41B1AB1FA3CF4B243E"},
+			},
+			Prefix: &Prefix{
+				Name: "nick",
+				User: "user",
+				Host: "example.com",
+			},
+			Command:  "PRIVMSG",
+			Params:   []string{"#channel"},
+			Trailing: "Hello",
+		},
+		rawMessage: "@time=2011-10-19T16:40:51.620Z;msgid=63E1033A051D4B41B1AB1FA3CF4B243E :nick!user@example.com PRIVMSG #channel :Hello",
+		rawPrefix:  "nick!user@example.com",
+		hostmask:   true,
+	},
+	{
+		parsed: &Message{
+			Tags: Tags{
+				{Key: "+example.com/reply", Value: "a; b\\c"},
+				{Key: "+typing"},
+			},
+			Command: "TAGMSG",
+			Params:  []string{"#channel"},
+		},
+		rawMessage: "@+example.com/reply=a\\:\\sb\\\\c;+typing TAGMSG #channel",
+	},
+	{
+		rawMessage: "@time=2011-10-19T16:40:51.620Z",
+	},
 }
 
 // -----
@@ -567,3 +602,53 @@ func BenchmarkParseMessage_long(b *testing.B) {
 		ParseMessage(":Namename!username@hostname COMMAND arg1 arg2 arg3 arg4 arg5 arg6 arg7 :Message message message message message\r\n")
 	}
 }
+
+// -----
+// TRUNCATION
+// -----
+
+func TestMessage_Bytes_utf8(t *testing.T) {
+	m := &Message{
+		Command:  "PRIVMSG",
+		Params:   []string{"#test"},
+		Trailing: strings.Repeat("€", 200),
+	}
+
+	b := m.Bytes()
+
+	if !utf8.Valid(b) {
+		t.Error("Truncated message contains invalid UTF-8.")
+	}
+	if len(b) > maxLength || len(b) < maxLength-2 {
+		t.Errorf("Unexpected message length %d", len(b))
+	}
+}
+
+var truncateTests = [...]*struct {
+	trailing  string
+	maxBytes  int
+	ellipsis  string
+	truncated string
+}{
+	{"short", 10, "", "short"},
+	{"Hello world", 5, "", "Hello"},
+	{"Hello world", 8, "...", "Hello..."},
+	{"Hello world", 2, "...", "He"},
+	{"héllo", 2, "", "h"},
+	{"日本語", 8, "…", "日…"},
+}
+
+func TestMessage_TruncateTrailing(t *testing.T) {
+	for i, test := range truncateTests {
+		m := &Message{Command: "PRIVMSG", Trailing: test.trailing}
+
+		if ok := m.TruncateTrailingEllipsis(test.maxBytes, test.ellipsis); ok != (test.trailing != test.truncated) {
+			t.Errorf("Wrong result for truncation %d", i)
+		}
+		if m.Trailing != test.truncated {
+			t.Errorf("Failed truncation %d:", i)
+			t.Logf("Output: %q", m.Trailing)
+			t.Logf("Expected: %q", test.truncated)
+		}
+	}
+}
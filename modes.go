@@ -0,0 +1,165 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+)
+
+// Various constants used for formatting mode strings.
+const (
+	modeAdd    byte = 0x2B // +
+	modeRemove byte = 0x2D // -
+)
+
+// ErrMissingModeParam is returned by ParseModeChange when a mode requires a
+// parameter, but none is left.
+var ErrMissingModeParam = errors.New("irc: missing mode parameter")
+
+// ModeChange represents a single channel mode being set or unset.
+type ModeChange struct {
+	Add   bool   // True if the mode is set, false if it is unset
+	Mode  byte   // Mode character, such as ModeOperator
+	Param string // Parameter, or empty if the mode takes none
+}
+
+// String returns the mode with its sign, such as "+o".
+func (c ModeChange) String() string {
+	if c.Add {
+		return string([]byte{modeAdd, c.Mode})
+	}
+	return string([]byte{modeRemove, c.Mode})
+}
+
+// HasParam returns true if mode takes a parameter when set (add is true) or
+// unset. Modes that are not listed take no parameter.
+func (c ChanModes) HasParam(mode byte, add bool) bool {
+	switch {
+	case indexByte(c.Prefix, mode) >= 0, indexByte(c.List, mode) >= 0, indexByte(c.Always, mode) >= 0:
+		return true
+	case indexByte(c.SetOnly, mode) >= 0:
+		return add
+	}
+	return false
+}
+
+// ParseModeChange parses the parameters of a channel MODE message, after the
+// channel name, into individual changes:
+//
+//    +ovk-l alice bob secret     -> +o alice, +v bob, +k secret, -l
+//    +b *!*@*.edu +e *!*@*.bu.edu -> +b *!*@*.edu, +e *!*@*.bu.edu
+//
+// Modes use the parameter classes from modes, see ISupport.ChanModes.
+// If a parameter is missing, the changes parsed so far are returned along
+// with ErrMissingModeParam.
+func ParseModeChange(params []string, modes ChanModes) (changes []ModeChange, err error) {
+
+	for i := 0; i < len(params); {
+
+		s := params[i]
+		i++
+		add := true
+
+		for j := 0; j < len(s); j++ {
+
+			switch s[j] {
+			case modeAdd:
+				add = true
+				continue
+			case modeRemove:
+				add = false
+				continue
+			}
+
+			change := ModeChange{Add: add, Mode: s[j]}
+
+			if modes.HasParam(s[j], add) {
+				if i >= len(params) {
+					return changes, ErrMissingModeParam
+				}
+				change.Param = params[i]
+				i++
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// BuildModeMessages returns the MODE messages applying changes to target,
+// using as few messages as possible.
+//
+// Each message contains at most maxParams changes with a parameter, see
+// ISupport.Modes. A maxParams of zero or less means there is no limit. Messages
+// are also kept short enough to be relayed by the server.
+func BuildModeMessages(target string, changes []ModeChange, maxParams int) (messages []*Message) {
+
+	var (
+		modes  []byte
+		params []string
+		count  int
+		length int
+		sign   byte
+	)
+
+	// The server prepends our prefix when relaying the message.
+	limit := maxLength - relayPrefixLength - len(MODE) - len(target) - 2
+
+	flush := func() {
+		if len(modes) > 0 {
+			messages = append(messages, &Message{
+				Command: MODE,
+				Params:  append([]string{target, string(modes)}, params...),
+			})
+		}
+		modes, params, count, length, sign = nil, nil, 0, 0, 0
+	}
+
+	for _, change := range changes {
+
+		s := modeRemove
+		if change.Add {
+			s = modeAdd
+		}
+
+		l := modeLength(change, s != sign)
+
+		if len(modes) > 0 && (length+l > limit || (len(change.Param) > 0 && maxParams > 0 && count >= maxParams)) {
+			flush()
+			l = modeLength(change, true)
+		}
+
+		if s != sign {
+			modes = append(modes, s)
+			sign = s
+		}
+		modes = append(modes, change.Mode)
+
+		if len(change.Param) > 0 {
+			params = append(params, change.Param)
+			count++
+		}
+
+		length = length + l
+	}
+
+	flush()
+
+	return messages
+}
+
+// modeLength returns the length a change adds to a MODE message, including
+// its sign if needed and parameter.
+func modeLength(change ModeChange, sign bool) (length int) {
+	if length = 1; sign {
+		length++
+	}
+	if len(change.Param) > 0 {
+		length = length + len(change.Param) + 1
+	}
+	return length
+}
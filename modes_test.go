@@ -0,0 +1,110 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testChanModes = ChanModes{
+	List:    "beI",
+	Always:  "k",
+	SetOnly: "l",
+	Never:   "imnpst",
+	Prefix:  "ov",
+}
+
+var modeChangeTests = [...]*struct {
+	params  string
+	changes []ModeChange
+	err     error
+}{
+	{
+		params: "+ovk-l alice bob secret",
+		changes: []ModeChange{
+			{true, 'o', "alice"},
+			{true, 'v', "bob"},
+			{true, 'k', "secret"},
+			{false, 'l', ""},
+		},
+	},
+	{
+		params: "+b *!*@*.edu +e *!*@*.bu.edu",
+		changes: []ModeChange{
+			{true, 'b', "*!*@*.edu"},
+			{true, 'e', "*!*@*.bu.edu"},
+		},
+	},
+	{
+		params: "-k+lm-o * 10 alice",
+		changes: []ModeChange{
+			{false, 'k', "*"},
+			{true, 'l', "10"},
+			{true, 'm', ""},
+			{false, 'o', "alice"},
+		},
+	},
+	{
+		params: "+ob alice",
+		changes: []ModeChange{
+			{true, 'o', "alice"},
+		},
+		err: ErrMissingModeParam,
+	},
+}
+
+func TestParseModeChange(t *testing.T) {
+	for i, test := range modeChangeTests {
+		changes, err := ParseModeChange(strings.Fields(test.params), testChanModes)
+
+		if err != test.err || !reflect.DeepEqual(changes, test.changes) {
+			t.Errorf("Failed to parse mode change %d:", i)
+			t.Logf("Output: %v %v", changes, err)
+			t.Logf("Expected: %v %v", test.changes, test.err)
+		}
+	}
+}
+
+func TestBuildModeMessages(t *testing.T) {
+	changes := []ModeChange{
+		{true, 'o', "alice"},
+		{true, 'o', "bob"},
+		{false, 'v', "carol"},
+		{true, 'm', ""},
+		{true, 'k', "secret"},
+	}
+
+	var result []string
+	for _, m := range BuildModeMessages("#chan", changes, 3) {
+		result = append(result, m.String())
+	}
+
+	expected := []string{
+		"MODE #chan +oo-v+m alice bob carol",
+		"MODE #chan +k secret",
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Wrong MODE messages: %q", result)
+	}
+
+	if messages := BuildModeMessages("#chan", changes, 0); len(messages) != 1 {
+		t.Errorf("Without limit, changes should fit in a single message, got %d", len(messages))
+	}
+
+	// Long parameters are spread over multiple messages.
+	var bans []ModeChange
+	for i := 0; i < 20; i++ {
+		bans = append(bans, ModeChange{true, 'b', strings.Repeat("x", 40)})
+	}
+
+	for _, m := range BuildModeMessages("#chan", bans, 0) {
+		if m.Len()+relayPrefixLength > maxLength {
+			t.Errorf("MODE message is too long: %d", m.Len())
+		}
+	}
+}
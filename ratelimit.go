@@ -0,0 +1,154 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults used for RateLimiter settings that are not set.
+const (
+	rateBurst    = 5
+	rateInterval = 2 * time.Second
+)
+
+// RateLimiter delays outgoing messages so the server doesn't disconnect the
+// client for flooding. Set it as Encoder.RateLimiter to use it.
+//
+// It works like a token bucket: Burst messages can be sent right away, after
+// that a new message may be sent every Interval. Messages are sent in the
+// order they were queued, except for priority messages (PONG and QUIT) which
+// are sent immediately.
+//
+// When BytesPerToken is positive, messages cost an extra token for every
+// BytesPerToken bytes, like the penalties used by Hybrid and Solanum.
+type RateLimiter struct {
+	Burst         int           // Messages that can be sent at once, 5 if zero
+	Interval      time.Duration // Time to regain a token, 2 seconds if zero
+	BytesPerToken int           // Bytes per extra token, disabled if zero
+
+	tokens float64
+	last   time.Time
+	stats  RateLimiterStats
+	mu     sync.Mutex
+}
+
+// RateLimiterStats contains metrics about a RateLimiter.
+type RateLimiterStats struct {
+	Queued     int           // Messages waiting to be sent
+	Sent       uint64        // Messages allowed to be sent
+	TotalDelay time.Duration // Time messages spent waiting, in total
+	MaxDelay   time.Duration // Longest time a message had to wait
+}
+
+// NewRateLimiter returns a RateLimiter allowing burst messages at once and
+// a new message every interval.
+func NewRateLimiter(burst int, interval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Burst:    burst,
+		Interval: interval,
+	}
+}
+
+// Stats returns the current metrics.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Wait blocks until a message of given size may be sent, or until ctx is
+// done. Priority messages don't wait, but still use tokens.
+func (l *RateLimiter) Wait(ctx context.Context, size int, priority bool) error {
+
+	delay, cost := l.reserve(size, priority)
+
+	if delay <= 0 {
+		l.done(0)
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		l.done(delay)
+		return nil
+	case <-ctx.Done():
+		l.cancel(cost)
+		return ctx.Err()
+	}
+}
+
+// reserve takes the tokens for a message and returns how long to wait
+// before sending it.
+func (l *RateLimiter) reserve(size int, priority bool) (delay time.Duration, cost float64) {
+	burst, interval := float64(l.Burst), l.Interval
+	if burst <= 0 {
+		burst = rateBurst
+	}
+	if interval <= 0 {
+		interval = rateInterval
+	}
+
+	cost = 1
+	if l.BytesPerToken > 0 {
+		cost = cost + float64(size/l.BytesPerToken)
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else if l.tokens = l.tokens + float64(now.Sub(l.last))/float64(interval); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+
+	// Tokens may go negative, later messages wait until the debt is paid.
+	l.tokens = l.tokens - cost
+
+	if !priority && l.tokens < 0 {
+		delay = time.Duration(-l.tokens * float64(interval))
+		l.stats.Queued++
+	}
+
+	return delay, cost
+}
+
+// done updates the metrics after a message was allowed.
+func (l *RateLimiter) done(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if delay > 0 {
+		l.stats.Queued--
+	}
+	l.stats.Sent++
+	l.stats.TotalDelay = l.stats.TotalDelay + delay
+	if delay > l.stats.MaxDelay {
+		l.stats.MaxDelay = delay
+	}
+}
+
+// cancel returns the tokens of a message that won't be sent.
+func (l *RateLimiter) cancel(cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Queued--
+	l.tokens = l.tokens + cost
+}
+
+// isPriority returns true for commands that bypass the rate limiter.
+func isPriority(command string) bool {
+	return command == PONG || command == QUIT
+}
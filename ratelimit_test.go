@@ -0,0 +1,84 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	l := NewRateLimiter(2, 50*time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		l.Wait(ctx, 10, false)
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Third message should wait for a token, waited %s", elapsed)
+	}
+
+	stats := l.Stats()
+	if stats.Sent != 3 || stats.Queued != 0 || stats.MaxDelay <= 0 || stats.TotalDelay != stats.MaxDelay {
+		t.Errorf("Wrong stats: %#v", stats)
+	}
+
+	// Cancelled messages return their tokens.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, 10, false); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if stats = l.Stats(); stats.Sent != 3 || stats.Queued != 0 {
+		t.Errorf("Wrong stats after cancel: %#v", stats)
+	}
+}
+
+func TestRateLimiter_bytes(t *testing.T) {
+	l := &RateLimiter{Burst: 3, Interval: time.Hour, BytesPerToken: 100}
+
+	// Costs 3 tokens, emptying the bucket.
+	if delay, _ := l.reserve(250, false); delay != 0 {
+		t.Errorf("First message should not wait, got %s", delay)
+	}
+	if delay, _ := l.reserve(10, false); delay < 59*time.Minute {
+		t.Errorf("Second message should wait for a token, got %s", delay)
+	}
+}
+
+func TestEncoder_RateLimiter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+	enc.RateLimiter = NewRateLimiter(1, 100*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, text := range []string{"a", "b", "c"} {
+			enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#go"}, Trailing: text})
+		}
+	}()
+
+	// Wait until the second message is queued, PONG skips the queue.
+	time.Sleep(30 * time.Millisecond)
+
+	if queued := enc.RateLimiter.Stats().Queued; queued != 1 {
+		t.Errorf("Expected 1 queued message, got %d", queued)
+	}
+
+	enc.Encode(&Message{Command: PONG, Trailing: "12345"})
+	<-done
+
+	expected := "PRIVMSG #go :a\r\nPONG :12345\r\nPRIVMSG #go :b\r\nPRIVMSG #go :c\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Messages sent in wrong order: %q", buffer.String())
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/sorcix/irc/sasl"
+)
+
+// Reasons used in RegistrationError.
+var (
+	ErrPasswordMismatch = errors.New("password incorrect")
+	ErrBanned           = errors.New("banned from server")
+	ErrNoNickname       = errors.New("no nickname available")
+	ErrServerClosed     = errors.New("closed by server")
+	ErrSASLUnavailable  = errors.New("SASL mechanism not supported by server")
+	ErrSASLFailed       = errors.New("SASL authentication failed")
+)
+
+// Capability required for SASL authentication.
+const capSASL = "sasl"
+
+// RegistrationError describes why the server refused to register a connection.
+type RegistrationError struct {
+	Message *Message // The message that caused registration to fail
+	Err     error    // Reason, one of the Err* values above
+}
+
+// Error implements the error interface.
+func (e *RegistrationError) Error() string {
+	s := "irc: registration failed: " + e.Err.Error()
+	if e.Message != nil && len(e.Message.Trailing) > 0 {
+		s = s + " (" + e.Message.Trailing + ")"
+	}
+	return s
+}
+
+// Unwrap returns the reason of this error.
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// RegistrationConfig contains the information sent to the server by Register.
+type RegistrationConfig struct {
+	Password string   // Connection password, sent using PASS if not empty
+	Nick     string   // Preferred nickname
+	AltNicks []string // Nicknames to try when the preferred one is unavailable
+	User     string   // Username, defaults to Nick
+	RealName string   // Real name, defaults to User
+
+	// Capabilities to request using CAP, if the server supports them.
+	Caps []string
+
+	// Optional, used instead of a new CapNegotiator for Caps. Pass your own
+	// negotiator to keep handling cap-notify messages after registration.
+	// It is restarted by Register, and if SASL is set the sasl capability is
+	// added to the capabilities it requests.
+	Negotiator *CapNegotiator
+
+	// Optional SASL mechanism to authenticate with. Registration fails if the
+	// server does not support it, or authentication does not succeed.
+	SASL sasl.Mechanism
+}
+
+// Welcome contains the information a server sends after registration.
+type Welcome struct {
+	Nick         string    // Our nickname, as confirmed by the server
+	Server       string    // Server name
+	Version      string    // Server version from RPL_MYINFO
+	UserModes    string    // Available user modes from RPL_MYINFO
+	ChannelModes string    // Available channel modes from RPL_MYINFO
+	ISupport     *ISupport // Features from RPL_ISUPPORT
+	Caps         *Caps     // Available and enabled capabilities
+	Account      string    // Account name after SASL authentication
+	MOTD         []string  // Message of the day
+}
+
+// Register sends the registration commands (CAP, PASS, NICK and USER) and
+// waits until the server has sent its welcome messages and message of the day.
+// If a SASL mechanism is configured, authentication happens before
+// capability negotiation ends.
+//
+// Alternative nicknames are tried when the server refuses a nickname. Servers
+// asking for a PING reply before completing registration are answered
+// automatically. A *RegistrationError is returned when the server refuses the
+// connection. Messages received during registration that are not part of the
+// Welcome are discarded.
+//
+// Connections made by DialWithConfig with an STSStore handle STS policies. An
+// insecure connection is closed with an *STSUpgradeError if the server
+// requires TLS.
+//
+// Cancelling ctx aborts registration. See DecodeContext.
+func (c *Conn) Register(ctx context.Context, config RegistrationConfig) (*Welcome, error) {
+
+	nicks := append([]string{config.Nick}, config.AltNicks...)
+	user := config.User
+	if len(user) <= 0 {
+		user = config.Nick
+	}
+	realName := config.RealName
+	if len(realName) <= 0 {
+		realName = user
+	}
+
+	var (
+		w          = &Welcome{Caps: NewCaps(), ISupport: NewISupport()}
+		registered bool
+		loggedIn   bool
+		messages   []*Message
+		auth       *sasl.Client
+	)
+
+	neg := config.Negotiator
+	if neg == nil && (len(config.Caps) > 0 || config.SASL != nil || c.sts != nil) {
+		neg = NewCapNegotiator(config.Caps...)
+	}
+	if neg != nil {
+		if config.SASL != nil && !contains(neg.want, capSASL) {
+			neg.want = append(neg.want, capSASL)
+		}
+		w.Caps = neg.Caps
+		messages = append(messages, neg.Start())
+	}
+	if len(config.Password) > 0 {
+		messages = append(messages, &Message{Command: PASS, Params: []string{config.Password}})
+	}
+	messages = append(messages,
+		&Message{Command: NICK, Params: []string{nicks[0]}},
+		&Message{Command: USER, Params: []string{user, "0", "*"}, Trailing: realName},
+	)
+
+	for _, m := range messages {
+		if err := c.EncodeContext(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		m, err := c.DecodeContext(ctx)
+
+		switch err.(type) {
+		case nil:
+		case *ParseError:
+			continue
+		default:
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+
+		switch m.Command {
+
+		case PING:
+			if c.getKeepalive() != nil {
+				// Answered by Decode already.
+				break
+			}
+			err = c.EncodeContext(ctx, &Message{Command: PONG, Params: m.Params, Trailing: m.Trailing, EmptyTrailing: m.EmptyTrailing})
+
+		case CAP:
+			if neg == nil {
+				break
+			}
+			done := neg.Done()
+			for _, reply := range neg.Handle(m) {
+				if err = c.EncodeContext(ctx, reply); err != nil {
+					return nil, err
+				}
+			}
+			if len(m.Params) > 1 && (m.Params[1] == CAP_LS || m.Params[1] == CAP_NEW) {
+				if err = c.applySTS(neg.Caps); err != nil {
+					return nil, err
+				}
+			}
+			if done || !neg.Done() {
+				break
+			}
+			if config.SASL == nil {
+				err = c.EncodeContext(ctx, neg.End())
+				break
+			}
+			if !saslSupported(neg.Caps, config.SASL.Name()) {
+				return nil, &RegistrationError{m, ErrSASLUnavailable}
+			}
+			auth = sasl.NewClient(config.SASL)
+			err = c.EncodeContext(ctx, &Message{Command: AUTHENTICATE, Params: []string{auth.Start()}})
+
+		case AUTHENTICATE:
+			if auth == nil {
+				break
+			}
+			param := m.Trailing
+			if len(m.Params) > 0 {
+				param = m.Params[0]
+			}
+			var params []string
+			if params, err = auth.Handle(param); err != nil {
+				c.EncodeContext(ctx, &Message{Command: AUTHENTICATE, Params: []string{sasl.Abort()}})
+				return nil, &RegistrationError{m, ErrSASLFailed}
+			}
+			for _, p := range params {
+				if err = c.EncodeContext(ctx, &Message{Command: AUTHENTICATE, Params: []string{p}}); err != nil {
+					break
+				}
+			}
+
+		case RPL_LOGGEDIN:
+			if len(m.Params) > 2 {
+				w.Account = m.Params[2]
+			}
+
+		case RPL_SASLSUCCESS:
+			if auth != nil {
+				loggedIn = true
+				err = c.EncodeContext(ctx, neg.End())
+			}
+
+		case ERR_SASLFAIL, ERR_SASLTOOLONG, ERR_SASLABORTED, RPL_NICKLOCKED:
+			return nil, &RegistrationError{m, ErrSASLFailed}
+
+		case ERR_NICKNAMEINUSE, ERR_ERRONEUSNICKNAME, ERR_NICKCOLLISION, ERR_UNAVAILRESOURCE:
+			if registered {
+				break
+			}
+			if nicks = nicks[1:]; len(nicks) <= 0 {
+				return nil, &RegistrationError{m, ErrNoNickname}
+			}
+			err = c.EncodeContext(ctx, &Message{Command: NICK, Params: []string{nicks[0]}})
+
+		case ERR_PASSWDMISMATCH:
+			return nil, &RegistrationError{m, ErrPasswordMismatch}
+
+		case ERR_YOUREBANNEDCREEP:
+			return nil, &RegistrationError{m, ErrBanned}
+
+		case ERROR:
+			return nil, &RegistrationError{m, ErrServerClosed}
+
+		case RPL_WELCOME:
+			// The server ignored CAP, or registered us before authenticating.
+			if config.SASL != nil && !loggedIn {
+				return nil, &RegistrationError{m, ErrSASLUnavailable}
+			}
+			registered = true
+			if len(m.Params) > 0 {
+				w.Nick = m.Params[0]
+			}
+			if m.Prefix != nil {
+				w.Server = m.Prefix.Name
+			}
+
+		case RPL_MYINFO:
+			if len(m.Params) >= 5 {
+				w.Server = m.Params[1]
+				w.Version = m.Params[2]
+				w.UserModes = m.Params[3]
+				w.ChannelModes = m.Params[4]
+			}
+
+		case RPL_ISUPPORT:
+			w.ISupport.Update(m)
+
+		case RPL_MOTD:
+			w.MOTD = append(w.MOTD, strings.TrimPrefix(m.Trailing, "- "))
+
+		case RPL_ENDOFMOTD, ERR_NOMOTD:
+			if registered {
+				return w, nil
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// saslSupported returns true if the sasl capability is enabled and, if the
+// server lists its mechanisms, includes mechanism.
+func saslSupported(caps *Caps, mechanism string) bool {
+	if !caps.Enabled(capSASL) {
+		return false
+	}
+	value, _ := caps.Value(capSASL)
+	return len(value) <= 0 || contains(strings.Split(value, ","), mechanism)
+}
+
+// contains returns true if s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,325 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc/sasl"
+)
+
+// testServer runs handler for every message the client sends over the
+// returned connection. The done channel is closed when the server stops,
+// after the client closed the connection.
+func testServer(t *testing.T, handler func(m *Message, enc *Encoder)) (c *Conn, done <-chan struct{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		server, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+
+		dec := NewDecoder(server)
+		enc := NewEncoder(server)
+
+		for {
+			m, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			handler(m, enc)
+		}
+	}()
+
+	if c, err = Dial(l.Addr().String()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	return c, exited
+}
+
+// send writes raw IRC messages, without validation.
+func send(enc *Encoder, raw ...string) {
+	for _, s := range raw {
+		enc.Write([]byte(s))
+	}
+}
+
+func TestConn_Register(t *testing.T) {
+	var received []string
+
+	c, done := testServer(t, func(m *Message, enc *Encoder) {
+		received = append(received, m.String())
+
+		switch {
+		case m.Command == CAP && m.Params[0] == CAP_LS:
+			send(enc, ":irc.test CAP * LS * :multi-prefix sasl=PLAIN", ":irc.test CAP * LS :server-time")
+		case m.Command == CAP && m.Params[0] == CAP_REQ:
+			send(enc, ":irc.test CAP * ACK :"+m.Trailing)
+		case m.Command == NICK && m.Params[0] == "taken":
+			send(enc, ":irc.test 433 * taken :Nickname is already in use")
+		case m.Command == USER:
+			send(enc, "PING :12345")
+		case m.Command == PONG:
+			send(enc,
+				":irc.test 001 bot :Welcome",
+				":irc.test 004 bot irc.test ircd-1.0 iow ovbk",
+				":irc.test 005 bot NETWORK=Test CHANTYPES=# :are supported by this server",
+				":irc.test 375 bot :- irc.test Message of the day -",
+				":irc.test 372 bot :- Hello!",
+				":irc.test 376 bot :End of /MOTD command.",
+			)
+		}
+	})
+
+	w, err := c.Register(context.Background(), RegistrationConfig{
+		Password: "secret",
+		Nick:     "taken",
+		AltNicks: []string{"bot"},
+		RealName: "Test Bot",
+		Caps:     []string{"server-time", "sasl", "unknown"},
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	expected := &Welcome{
+		Nick:         "bot",
+		Server:       "irc.test",
+		Version:      "ircd-1.0",
+		UserModes:    "iow",
+		ChannelModes: "ovbk",
+		ISupport:     w.ISupport,
+		Caps:         w.Caps,
+		MOTD:         []string{"Hello!"},
+	}
+
+	if w.ISupport.Network() != "Test" || w.ISupport.ChanTypes() != "#" {
+		t.Errorf("Wrong ISUPPORT tokens: %#v", w.ISupport)
+	}
+
+	if !reflect.DeepEqual(w.Caps.List(), []string{"sasl", "server-time"}) {
+		t.Errorf("Wrong capabilities enabled: %q", w.Caps.List())
+	}
+
+	if !reflect.DeepEqual(w, expected) {
+		t.Errorf("Welcome looks wrong: %#v", w)
+	}
+
+	c.Close()
+	<-done
+
+	sent := []string{
+		"CAP LS 302",
+		"PASS secret",
+		"NICK taken",
+		"USER taken 0 * :Test Bot",
+		"CAP REQ :server-time sasl",
+		"NICK bot",
+		"PONG :12345",
+		"CAP END",
+	}
+
+	if !reflect.DeepEqual(received, sent) {
+		t.Errorf("Client sent unexpected messages: %q", received)
+	}
+}
+
+func TestConn_Register_errors(t *testing.T) {
+	c, _ := testServer(t, func(m *Message, enc *Encoder) {
+		if m.Command == USER {
+			send(enc, ":irc.test 464 * :Password incorrect")
+		}
+	})
+	defer c.Close()
+
+	_, err := c.Register(context.Background(), RegistrationConfig{Nick: "bot"})
+
+	if rerr, ok := err.(*RegistrationError); !ok || rerr.Err != ErrPasswordMismatch {
+		t.Errorf("Expected ErrPasswordMismatch, got %v", err)
+	}
+
+	c, _ = testServer(t, func(m *Message, enc *Encoder) {
+		if m.Command == NICK {
+			send(enc, ":irc.test 433 * "+m.Params[0]+" :Nickname is already in use")
+		}
+	})
+	defer c.Close()
+
+	_, err = c.Register(context.Background(), RegistrationConfig{Nick: "a", AltNicks: []string{"b"}})
+
+	if rerr, ok := err.(*RegistrationError); !ok || rerr.Err != ErrNoNickname {
+		t.Errorf("Expected ErrNoNickname, got %v", err)
+	}
+}
+
+func TestConn_Register_cancel(t *testing.T) {
+	c, _ := testServer(t, func(m *Message, enc *Encoder) {})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Register(ctx, RegistrationConfig{Nick: "bot"}); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestConn_Register_sasl(t *testing.T) {
+	var received []string
+
+	c, done := testServer(t, func(m *Message, enc *Encoder) {
+		received = append(received, m.String())
+
+		switch {
+		case m.Command == CAP && m.Params[0] == CAP_LS:
+			send(enc, ":irc.test CAP * LS :sasl=EXTERNAL,PLAIN")
+		case m.Command == CAP && m.Params[0] == CAP_REQ:
+			send(enc, ":irc.test CAP * ACK :"+m.Trailing)
+		case m.Command == AUTHENTICATE && m.Params[0] == "PLAIN":
+			send(enc, "AUTHENTICATE +")
+		case m.Command == AUTHENTICATE:
+			send(enc,
+				":irc.test 900 bot bot!bot@host account :You are now logged in as account",
+				":irc.test 903 bot :SASL authentication successful",
+			)
+		case m.Command == CAP && m.Params[0] == CAP_END:
+			send(enc, ":irc.test 001 bot :Welcome", ":irc.test 422 bot :MOTD File is missing")
+		}
+	})
+
+	w, err := c.Register(context.Background(), RegistrationConfig{
+		Nick: "bot",
+		SASL: sasl.NewPlain("", "account", "password"),
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if w.Account != "account" || !w.Caps.Enabled("sasl") {
+		t.Errorf("Welcome looks wrong: %#v", w)
+	}
+
+	c.Close()
+	<-done
+
+	sent := []string{
+		"CAP LS 302",
+		"NICK bot",
+		"USER bot 0 * :bot",
+		"CAP REQ :sasl",
+		"AUTHENTICATE PLAIN",
+		"AUTHENTICATE AGFjY291bnQAcGFzc3dvcmQ=",
+		"CAP END",
+	}
+
+	if !reflect.DeepEqual(received, sent) {
+		t.Errorf("Client sent unexpected messages: %q", received)
+	}
+}
+
+func TestConn_Register_saslUnavailable(t *testing.T) {
+	c, _ := testServer(t, func(m *Message, enc *Encoder) {
+		switch {
+		case m.Command == CAP && m.Params[0] == CAP_LS:
+			send(enc, ":irc.test CAP * LS :sasl=EXTERNAL")
+		case m.Command == CAP && m.Params[0] == CAP_REQ:
+			send(enc, ":irc.test CAP * ACK :"+m.Trailing)
+		}
+	})
+	defer c.Close()
+
+	_, err := c.Register(context.Background(), RegistrationConfig{
+		Nick: "bot",
+		SASL: sasl.NewPlain("", "account", "password"),
+	})
+
+	if rerr, ok := err.(*RegistrationError); !ok || rerr.Err != ErrSASLUnavailable {
+		t.Errorf("Expected ErrSASLUnavailable, got %v", err)
+	}
+}
+
+func TestConn_Register_saslIgnored(t *testing.T) {
+	c, _ := testServer(t, func(m *Message, enc *Encoder) {
+		if m.Command == USER {
+			send(enc, ":irc.test 001 bot :Welcome", ":irc.test 376 bot :End of MOTD")
+		}
+	})
+	defer c.Close()
+
+	_, err := c.Register(context.Background(), RegistrationConfig{
+		Nick: "bot",
+		SASL: sasl.NewPlain("", "account", "password"),
+	})
+
+	if rerr, ok := err.(*RegistrationError); !ok || rerr.Err != ErrSASLUnavailable {
+		t.Errorf("Expected ErrSASLUnavailable, got %v", err)
+	}
+}
+
+func TestConn_Register_saslMechanismError(t *testing.T) {
+	c, _ := testServer(t, func(m *Message, enc *Encoder) {
+		switch {
+		case m.Command == CAP && m.Params[0] == CAP_LS:
+			send(enc, ":irc.test CAP * LS :sasl=PLAIN")
+		case m.Command == CAP && m.Params[0] == CAP_REQ:
+			send(enc, ":irc.test CAP * ACK :"+m.Trailing)
+		case m.Command == AUTHENTICATE && m.Params[0] != sasl.Abort():
+			// PLAIN doesn't expect a second challenge.
+			send(enc, "AUTHENTICATE +")
+		}
+	})
+	defer c.Close()
+
+	_, err := c.Register(context.Background(), RegistrationConfig{
+		Nick: "bot",
+		SASL: sasl.NewPlain("", "account", "password"),
+	})
+
+	if rerr, ok := err.(*RegistrationError); !ok || rerr.Err != ErrSASLFailed {
+		t.Errorf("Expected ErrSASLFailed, got %v", err)
+	}
+}
+
+func TestConn_Register_reuseNegotiator(t *testing.T) {
+	neg := NewCapNegotiator("multi-prefix")
+
+	for i := 0; i < 2; i++ {
+		c, _ := testServer(t, func(m *Message, enc *Encoder) {
+			switch {
+			case m.Command == CAP && m.Params[0] == CAP_LS:
+				send(enc, ":irc.test CAP * LS :multi-prefix")
+			case m.Command == CAP && m.Params[0] == CAP_REQ:
+				send(enc, ":irc.test CAP * ACK :"+m.Trailing)
+			case m.Command == CAP && m.Params[0] == CAP_END:
+				send(enc, ":irc.test 001 bot :Welcome", ":irc.test 422 bot :MOTD File is missing")
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		w, err := c.Register(ctx, RegistrationConfig{Nick: "bot", Negotiator: neg})
+		cancel()
+		c.Close()
+
+		if err != nil || !w.Caps.Enabled("multi-prefix") {
+			t.Fatalf("Registration %d failed: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+// Package sasl implements SASL authentication for IRC.
+//
+// IRC servers supporting the IRCv3 sasl capability accept authentication
+// using the AUTHENTICATE command. This package implements the PLAIN,
+// EXTERNAL and SCRAM-SHA-256 mechanisms, and the base64 encoding and 400 byte
+// chunking used by AUTHENTICATE.
+//
+// Example using the irc.Message type:
+//
+//    client := sasl.NewClient(sasl.NewPlain("", "user", "password"))
+//
+//    // Send AUTHENTICATE PLAIN
+//    enc.Encode(&irc.Message{Command: irc.AUTHENTICATE, Params: []string{client.Start()}})
+//
+//    // For every AUTHENTICATE message received from the server:
+//    responses, err := client.Handle(m.Params[0])
+//    for _, response := range responses {
+//        enc.Encode(&irc.Message{Command: irc.AUTHENTICATE, Params: []string{response}})
+//    }
+//
+// Most applications don't need to use this package directly, see the SASL
+// field of irc.RegistrationConfig.
+package sasl
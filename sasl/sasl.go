@@ -0,0 +1,195 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package sasl
+
+// Sources:
+// https://ircv3.net/specs/extensions/sasl-3.1
+// https://tools.ietf.org/html/rfc4616 (PLAIN)
+// https://tools.ietf.org/html/rfc4422#appendix-A (EXTERNAL)
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Various constants used for formatting AUTHENTICATE messages.
+const (
+	chunkSize = 400 // Maximum length of a single AUTHENTICATE parameter.
+	empty     = "+" // Empty payload, or end of a payload of exactly chunkSize bytes.
+	abort     = "*" // Aborts authentication.
+)
+
+// Mechanism names.
+const (
+	PLAIN       = "PLAIN"
+	EXTERNAL    = "EXTERNAL"
+	SCRAMSHA256 = "SCRAM-SHA-256"
+)
+
+// ErrUnexpectedChallenge is returned by mechanisms receiving more challenges
+// than they expect.
+var ErrUnexpectedChallenge = errors.New("sasl: unexpected challenge")
+
+// Mechanism represents the client side of a SASL mechanism.
+type Mechanism interface {
+	// Name returns the mechanism name, as used in AUTHENTICATE.
+	Name() string
+
+	// Next returns the response to a challenge from the server.
+	// The first challenge is usually empty.
+	Next(challenge []byte) (response []byte, err error)
+}
+
+// Resetter is implemented by mechanisms that keep state during an
+// authentication. NewClient calls Reset before starting, so a Mechanism
+// implementing it can be used for multiple authentications, one at a time.
+type Resetter interface {
+	// Reset prepares the mechanism for a new authentication.
+	Reset()
+}
+
+// Encode returns the AUTHENTICATE parameters for a response.
+//
+// The response is base64 encoded and split into chunks of 400 bytes.
+// Empty responses, and responses ending with a full chunk, are terminated
+// by a "+" parameter.
+func Encode(response []byte) (params []string) {
+
+	s := base64.StdEncoding.EncodeToString(response)
+
+	for len(s) >= chunkSize {
+		params = append(params, s[:chunkSize])
+		s = s[chunkSize:]
+	}
+
+	if len(s) > 0 {
+		return append(params, s)
+	}
+
+	return append(params, empty)
+}
+
+// Abort returns the AUTHENTICATE parameter that aborts authentication.
+func Abort() string {
+	return abort
+}
+
+// Client runs a Mechanism over AUTHENTICATE messages.
+type Client struct {
+	mechanism Mechanism
+	buffer    []string
+}
+
+// NewClient returns a new Client for mechanism m, resetting m if it
+// implements Resetter.
+func NewClient(m Mechanism) *Client {
+	if r, ok := m.(Resetter); ok {
+		r.Reset()
+	}
+	return &Client{
+		mechanism: m,
+	}
+}
+
+// Start returns the parameter of the AUTHENTICATE message that starts
+// authentication, the mechanism name.
+func (c *Client) Start() string {
+	return c.mechanism.Name()
+}
+
+// Handle processes the parameter of an AUTHENTICATE message received from the
+// server and returns the parameters to send back.
+//
+// Challenges split over multiple messages are collected first, Handle returns
+// no parameters until the last chunk is received.
+func (c *Client) Handle(param string) (params []string, err error) {
+
+	if param != empty {
+		c.buffer = append(c.buffer, param)
+	}
+
+	// More chunks follow.
+	if len(param) == chunkSize {
+		return nil, nil
+	}
+
+	challenge, err := base64.StdEncoding.DecodeString(strings.Join(c.buffer, ""))
+	c.buffer = nil
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.mechanism.Next(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(response), nil
+}
+
+// plain implements the PLAIN mechanism.
+type plain struct {
+	identity, username, password string
+	done                         bool
+}
+
+// NewPlain returns the PLAIN mechanism, sending username and password in
+// plain text. The identity to act as is usually empty.
+//
+// The mechanism is reset by NewClient, so it can be used for multiple
+// authentications, but not concurrently.
+func NewPlain(identity, username, password string) Mechanism {
+	return &plain{identity: identity, username: username, password: password}
+}
+
+func (p *plain) Name() string {
+	return PLAIN
+}
+
+func (p *plain) Reset() {
+	p.done = false
+}
+
+func (p *plain) Next(challenge []byte) ([]byte, error) {
+	if p.done {
+		return nil, ErrUnexpectedChallenge
+	}
+	p.done = true
+	return []byte(p.identity + "\x00" + p.username + "\x00" + p.password), nil
+}
+
+// external implements the EXTERNAL mechanism.
+type external struct {
+	identity string
+	done     bool
+}
+
+// NewExternal returns the EXTERNAL mechanism, authenticating using
+// credentials established outside of SASL, such as a TLS client certificate.
+// The identity to act as is usually empty.
+//
+// The mechanism is reset by NewClient, so it can be used for multiple
+// authentications, but not concurrently.
+func NewExternal(identity string) Mechanism {
+	return &external{identity: identity}
+}
+
+func (e *external) Name() string {
+	return EXTERNAL
+}
+
+func (e *external) Reset() {
+	e.done = false
+}
+
+func (e *external) Next(challenge []byte) ([]byte, error) {
+	if e.done {
+		return nil, ErrUnexpectedChallenge
+	}
+	e.done = true
+	return []byte(e.identity), nil
+}
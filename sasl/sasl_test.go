@@ -0,0 +1,93 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package sasl
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	if params := Encode(nil); !reflect.DeepEqual(params, []string{"+"}) {
+		t.Errorf("Empty response should be encoded as +, got %q", params)
+	}
+
+	// 300 bytes encode to exactly 400 base64 characters.
+	params := Encode([]byte(strings.Repeat("a", 300)))
+	if len(params) != 2 || len(params[0]) != 400 || params[1] != "+" {
+		t.Errorf("Response of exactly one chunk should end with +, got %d params", len(params))
+	}
+
+	params = Encode([]byte(strings.Repeat("a", 400)))
+	if len(params) != 2 || len(params[0]) != 400 || len(params[1]) != 136 {
+		t.Errorf("Long response should be split into chunks, got %q", params)
+	}
+}
+
+func TestClient_Handle(t *testing.T) {
+	c := NewClient(NewPlain("", "user", "pass"))
+
+	if c.Start() != "PLAIN" {
+		t.Fatalf("Wrong mechanism: %s", c.Start())
+	}
+
+	params, err := c.Handle("+")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(params, []string{base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass"))}) {
+		t.Errorf("Wrong PLAIN response: %q", params)
+	}
+
+	if _, err := c.Handle("+"); err != ErrUnexpectedChallenge {
+		t.Errorf("Expected ErrUnexpectedChallenge, got %v", err)
+	}
+}
+
+func TestNewClient_reset(t *testing.T) {
+	for _, m := range []Mechanism{NewPlain("", "user", "pass"), NewExternal(""), NewScramSHA256("user", "pass")} {
+		first, _ := NewClient(m).Handle("+")
+		second, err := NewClient(m).Handle("+")
+		if err != nil || len(second) != 1 {
+			t.Errorf("%s should be reusable, got %q %v", m.Name(), second, err)
+		}
+		if m.Name() == SCRAMSHA256 && reflect.DeepEqual(first, second) {
+			t.Errorf("%s should use a new nonce", m.Name())
+		}
+	}
+}
+
+// echo returns challenges as responses.
+type echo struct{}
+
+func (echo) Name() string                          { return "ECHO" }
+func (echo) Next(challenge []byte) ([]byte, error) { return challenge, nil }
+
+func TestClient_Handle_chunks(t *testing.T) {
+	c := NewClient(echo{})
+	challenge := []byte(strings.Repeat("x", 600))
+	chunks := Encode(challenge)
+
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if params, err := c.Handle(chunk); params != nil || err != nil {
+			t.Fatal("Client should wait for the last chunk.")
+		}
+	}
+
+	params, err := c.Handle(chunks[len(chunks)-1])
+	if err != nil || !reflect.DeepEqual(params, chunks) {
+		t.Errorf("Client should reassemble chunks, got %q", params)
+	}
+}
+
+func TestExternal(t *testing.T) {
+	c := NewClient(NewExternal(""))
+
+	if params, err := c.Handle("+"); err != nil || !reflect.DeepEqual(params, []string{"+"}) {
+		t.Errorf("Wrong EXTERNAL response: %q", params)
+	}
+}
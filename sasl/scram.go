@@ -0,0 +1,195 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package sasl
+
+// Sources:
+// https://tools.ietf.org/html/rfc5802 (SCRAM)
+// https://tools.ietf.org/html/rfc7677 (SCRAM-SHA-256)
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by SCRAM-SHA-256.
+var (
+	ErrInvalidChallenge = errors.New("sasl: invalid SCRAM challenge")
+	ErrInvalidNonce     = errors.New("sasl: server nonce does not start with client nonce")
+	ErrServerSignature  = errors.New("sasl: invalid server signature")
+)
+
+// ServerError is returned by SCRAM-SHA-256 when the server reports an error.
+type ServerError string
+
+// Error implements the error interface.
+func (e ServerError) Error() string {
+	return "sasl: server error: " + string(e)
+}
+
+// Various constants used by SCRAM.
+const (
+	gs2Header   = "n,," // No channel binding, no identity
+	nonceLength = 24
+)
+
+// scram implements the SCRAM-SHA-256 mechanism.
+type scram struct {
+	username, password string
+
+	step        int
+	nonce       string // Client nonce
+	clientFirst string // client-first-message-bare
+	serverSig   []byte // Expected server signature
+}
+
+// NewScramSHA256 returns the SCRAM-SHA-256 mechanism, which proves knowledge
+// of the password without sending it to the server and verifies the server
+// knows it too.
+//
+// The username and password are used as given, SASLprep normalization is
+// not applied.
+//
+// The mechanism is reset by NewClient, so it can be used for multiple
+// authentications, but not concurrently. Every authentication uses a new
+// nonce.
+func NewScramSHA256(username, password string) Mechanism {
+	return &scram{username: username, password: password}
+}
+
+func (s *scram) Name() string {
+	return SCRAMSHA256
+}
+
+func (s *scram) Reset() {
+	s.step = 0
+	s.nonce = ""
+	s.clientFirst = ""
+	s.serverSig = nil
+}
+
+func (s *scram) Next(challenge []byte) ([]byte, error) {
+
+	s.step++
+
+	switch s.step {
+
+	case 1:
+		if len(s.nonce) <= 0 {
+			b := make([]byte, nonceLength)
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+			s.nonce = base64.RawStdEncoding.EncodeToString(b)
+		}
+		s.clientFirst = "n=" + escapeName(s.username) + ",r=" + s.nonce
+		return []byte(gs2Header + s.clientFirst), nil
+
+	case 2:
+		return s.clientFinal(string(challenge))
+
+	case 3:
+		attrs := parseAttributes(string(challenge))
+		if e, ok := attrs['e']; ok {
+			return nil, ServerError(e)
+		}
+		v, err := base64.StdEncoding.DecodeString(attrs['v'])
+		if err != nil || !hmac.Equal(v, s.serverSig) {
+			return nil, ErrServerSignature
+		}
+		return nil, nil
+
+	}
+
+	return nil, ErrUnexpectedChallenge
+}
+
+// clientFinal computes the client-final-message from the server-first-message.
+func (s *scram) clientFinal(serverFirst string) ([]byte, error) {
+
+	attrs := parseAttributes(serverFirst)
+
+	nonce := attrs['r']
+	salt, err := base64.StdEncoding.DecodeString(attrs['s'])
+	if err != nil || len(nonce) <= 0 || len(salt) <= 0 {
+		return nil, ErrInvalidChallenge
+	}
+	if !strings.HasPrefix(nonce, s.nonce) {
+		return nil, ErrInvalidNonce
+	}
+	iterations, err := strconv.Atoi(attrs['i'])
+	if err != nil || iterations <= 0 {
+		return nil, ErrInvalidChallenge
+	}
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(gs2Header)) + ",r=" + nonce
+	authMessage := []byte(s.clientFirst + "," + serverFirst + "," + withoutProof)
+
+	salted := pbkdf2(sha256.New, []byte(s.password), salt, iterations)
+	clientKey := mac(salted, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	clientSig := mac(storedKey[:], authMessage)
+
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSig[i]
+	}
+
+	s.serverSig = mac(mac(salted, []byte("Server Key")), authMessage)
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// mac returns HMAC-SHA-256(key, data).
+func mac(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// pbkdf2 implements PBKDF2 from RFC 2898 for a single block of output.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations int) []byte {
+	prf := hmac.New(h, password)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+
+	result := make([]byte, len(u))
+	copy(result, u)
+
+	for n := 1; n < iterations; n++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for i := range result {
+			result[i] ^= u[i]
+		}
+	}
+
+	return result
+}
+
+// parseAttributes splits a SCRAM message into its attributes.
+func parseAttributes(s string) map[byte]string {
+	attrs := make(map[byte]string)
+	for _, attr := range strings.Split(s, ",") {
+		if len(attr) >= 2 && attr[1] == '=' {
+			attrs[attr[0]] = attr[2:]
+		}
+	}
+	return attrs
+}
+
+var nameEscaper = strings.NewReplacer("=", "=3D", ",", "=2C")
+
+// escapeName escapes a username for use in a SCRAM message.
+func escapeName(name string) string {
+	return nameEscaper.Replace(name)
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package sasl
+
+import (
+	"testing"
+)
+
+// Test vector from RFC 7677 section 3.
+func TestScramSHA256(t *testing.T) {
+	m := NewScramSHA256("user", "pencil")
+	m.(*scram).nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	steps := [...]struct {
+		challenge, response string
+	}{
+		{
+			"",
+			"n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		},
+		{
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		},
+		{
+			"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+			"",
+		},
+	}
+
+	for i, step := range steps {
+		response, err := m.Next([]byte(step.challenge))
+		if err != nil {
+			t.Fatalf("Unexpected error in step %d: %s", i, err.Error())
+		}
+		if string(response) != step.response {
+			t.Errorf("Wrong response in step %d:", i)
+			t.Logf("Output: %s", response)
+			t.Logf("Expected: %s", step.response)
+		}
+	}
+}
+
+func TestScramSHA256_errors(t *testing.T) {
+	m := NewScramSHA256("user", "wrong")
+	m.(*scram).nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	m.Next(nil)
+	m.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+
+	if _, err := m.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != ErrServerSignature {
+		t.Errorf("Expected ErrServerSignature, got %v", err)
+	}
+
+	m = NewScramSHA256("user", "pencil")
+	m.(*scram).nonce = "abc"
+	m.Next(nil)
+
+	if _, err := m.Next([]byte("r=xyz,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")); err != ErrInvalidNonce {
+		t.Errorf("Expected ErrInvalidNonce, got %v", err)
+	}
+
+	if escapeName("a=b,c") != "a=3Db=2Cc" {
+		t.Error("Usernames should be escaped.")
+	}
+}
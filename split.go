@@ -0,0 +1,123 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Various constants used for splitting messages.
+const (
+	// Length reserved for the prefix a server adds when relaying a message:
+	// ':' <nick> '!' <user> '@' <host> ' ', assuming 30 byte nicknames,
+	// 10 byte usernames and 63 byte hostnames.
+	relayPrefixLength = 1 + 30 + 1 + 10 + 1 + 63 + 1
+
+	ctcpAction     = "\x01ACTION "
+	ctcpDelimiter  = "\x01"
+	minSplitLength = utf8.UTFMax
+)
+
+// SplitMessage splits the trailing parameter of m over multiple messages so
+// that none of them exceeds maxLen bytes once relayed by the server.
+// A maxLen of zero or less, or more than 510, means 510.
+//
+// The server prepends the sender's prefix when relaying a message to other
+// clients. If m has a Prefix, its length is used. Otherwise the length of a
+// long nick!user@host prefix is assumed.
+//
+// Text is split on spaces where possible, and never inside a UTF-8 encoded
+// rune. CTCP ACTION messages are split into multiple ACTION messages.
+// Tags are copied to every message and don't count towards maxLen.
+//
+// Returns a slice containing only m if it does not need to be split.
+func SplitMessage(m *Message, maxLen int) []*Message {
+
+	if maxLen <= 0 || maxLen > maxLength {
+		maxLen = maxLength
+	}
+
+	// Length of everything but the trailing text.
+	overhead := m.Len() - len(m.Trailing)
+	if len(m.Trailing) <= 0 && !m.EmptyTrailing {
+		overhead = overhead + 2
+	}
+	overhead = overhead - m.tagsLen()
+	if m.Prefix == nil {
+		overhead = overhead + relayPrefixLength
+	}
+
+	text, action := m.Trailing, false
+
+	// Keep the ACTION framing on every part.
+	if strings.HasPrefix(text, ctcpAction) {
+		text = strings.TrimSuffix(text[len(ctcpAction):], ctcpDelimiter)
+		overhead = overhead + len(ctcpAction) + len(ctcpDelimiter)
+		action = true
+	}
+
+	available := maxLen - overhead
+
+	if len(m.Trailing)+overhead <= maxLen || available < minSplitLength {
+		return []*Message{m}
+	}
+
+	var parts []string
+
+	for len(text) > available {
+		n := runeBoundary(text, available)
+
+		switch i := strings.LastIndex(text[:n+1], " "); {
+		case i > 0:
+			parts = append(parts, text[:i])
+			text = text[i+1:]
+		case i == 0:
+			text = text[1:]
+		default:
+			parts = append(parts, text[:n])
+			text = text[n:]
+		}
+	}
+
+	if len(text) > 0 {
+		parts = append(parts, text)
+	}
+
+	messages := make([]*Message, len(parts))
+
+	for i, part := range parts {
+		c := *m
+		if action {
+			part = ctcpAction + part + ctcpDelimiter
+		}
+		c.Trailing = part
+		if m.Tags != nil {
+			c.Tags = append(Tags(nil), m.Tags...)
+		}
+		if m.Params != nil {
+			c.Params = append([]string(nil), m.Params...)
+		}
+		messages[i] = &c
+	}
+
+	return messages
+}
+
+// runeBoundary returns the largest index i <= n at which s can be cut without
+// splitting a UTF-8 encoded rune.
+//
+// Text that is not valid UTF-8 is cut at n.
+func runeBoundary(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	for i := n; i > n-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(s[i]) {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var splitTests = [...]*struct {
+	message  *Message
+	maxLen   int
+	trailing []string
+}{
+	{
+		message: &Message{
+			Command:  PRIVMSG,
+			Params:   []string{"#channel"},
+			Trailing: "short",
+		},
+		trailing: []string{"short"},
+	},
+	{
+		message: &Message{
+			Prefix:   &Prefix{Name: "n"},
+			Command:  PRIVMSG,
+			Params:   []string{"#c"},
+			Trailing: "aaaa bbbb cccc dddd",
+		},
+		maxLen:   len(":n PRIVMSG #c :") + 9,
+		trailing: []string{"aaaa bbbb", "cccc dddd"},
+	},
+	{
+		message: &Message{
+			Prefix:   &Prefix{Name: "n"},
+			Command:  PRIVMSG,
+			Params:   []string{"#c"},
+			Trailing: "aaaaaaaaaaaa",
+		},
+		maxLen:   len(":n PRIVMSG #c :") + 5,
+		trailing: []string{"aaaaa", "aaaaa", "aa"},
+	},
+	{
+		message: &Message{
+			Prefix:   &Prefix{Name: "n"},
+			Command:  PRIVMSG,
+			Params:   []string{"#c"},
+			Trailing: "ééééé",
+		},
+		maxLen:   len(":n PRIVMSG #c :") + 5,
+		trailing: []string{"éé", "éé", "é"},
+	},
+	{
+		message: &Message{
+			Prefix:   &Prefix{Name: "n"},
+			Command:  PRIVMSG,
+			Params:   []string{"#c"},
+			Trailing: "\x01ACTION waves at everyone\x01",
+		},
+		maxLen:   len(":n PRIVMSG #c :\x01ACTION \x01") + 9,
+		trailing: []string{"\x01ACTION waves at\x01", "\x01ACTION everyone\x01"},
+	},
+}
+
+func TestSplitMessage(t *testing.T) {
+	for i, test := range splitTests {
+		parts := SplitMessage(test.message, test.maxLen)
+
+		if len(parts) != len(test.trailing) {
+			t.Errorf("Message %d split into %d parts, expected %d", i, len(parts), len(test.trailing))
+			continue
+		}
+
+		for j, part := range parts {
+			if part.Trailing != test.trailing[j] || part.Command != test.message.Command {
+				t.Errorf("Part %d of message %d looks wrong: %q", j, i, part.Trailing)
+			}
+			if test.maxLen > 0 && part.Len() > test.maxLen {
+				t.Errorf("Part %d of message %d is too long: %d", j, i, part.Len())
+			}
+		}
+	}
+}
+
+func TestSplitMessage_relayPrefix(t *testing.T) {
+	m := &Message{
+		Tags:     Tags{{Key: "+draft/reply", Value: "123"}},
+		Command:  NOTICE,
+		Params:   []string{"#channel"},
+		Trailing: strings.Repeat("é", 300),
+	}
+
+	parts := SplitMessage(m, 0)
+
+	if len(parts) != 2 {
+		t.Fatalf("Message split into %d parts, expected 2", len(parts))
+	}
+
+	for i, part := range parts {
+		if !utf8.ValidString(part.Trailing) {
+			t.Errorf("Part %d contains invalid UTF-8", i)
+		}
+		if part.Len()-part.Tags.Len()-2+relayPrefixLength > maxLength {
+			t.Errorf("Part %d is too long to be relayed: %d", i, part.Len())
+		}
+		if !part.Tags.Has("+draft/reply") {
+			t.Errorf("Part %d lost its tags", i)
+		}
+	}
+}
+
+func TestEncoder_Encode_split(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+	enc.SplitLength = relayPrefixLength + len("PRIVMSG #c :") + 4
+
+	if err := enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#c"}, Trailing: "abcd efgh"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	if buffer.String() != "PRIVMSG #c :abcd\r\nPRIVMSG #c :efgh\r\n" {
+		t.Fatalf("Encoded stream looks wrong: %q", buffer.String())
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+// Package state keeps track of channels and users on an IRC connection.
+//
+// A Tracker consumes the messages received from the server and maintains
+// the list of joined channels, their members, modes and topics, and the
+// users sharing a channel with us. Nicknames and channel names are compared
+// using the casemapping advertised in RPL_ISUPPORT.
+//
+// Example using the irc.Conn type:
+//
+//    tracker := state.NewTracker()
+//
+//    for {
+//        m, err := conn.Decode()
+//        ...
+//        tracker.Update(m)
+//    }
+//
+//    if channel, ok := tracker.Channel("#go-nuts"); ok {
+//        fmt.Println(channel.Topic)
+//    }
+//
+// All Tracker methods may be used from multiple goroutines. Channel and User
+// values are snapshots and don't change after they are returned.
+package state
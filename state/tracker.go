@@ -0,0 +1,555 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package state
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorcix/irc"
+)
+
+// Channel is a snapshot of a joined channel.
+type Channel struct {
+	Name       string
+	Topic      string
+	TopicSetBy string
+	TopicSetAt time.Time
+
+	// Channel modes, excluding list and membership modes. The value is
+	// the parameter, such as the key for mode k, or empty.
+	Modes map[byte]string
+
+	// Members and their membership modes, such as "ov", in order of rank.
+	Members map[string]string
+}
+
+// Key returns the channel key (mode k), or an empty string.
+func (c *Channel) Key() string {
+	return c.Modes[irc.ModeKey]
+}
+
+// User is a snapshot of a user sharing a channel with us.
+type User struct {
+	Nick     string
+	User     string
+	Host     string
+	RealName string
+	Account  string // Empty if not logged in or unknown
+	Away     bool
+
+	Channels []string // Shared channels, sorted
+}
+
+// Tracker keeps track of channels and users by consuming messages received
+// from the server.
+type Tracker struct {
+	isupport *irc.ISupport
+	mapping  irc.CaseMapping
+	me       string
+	channels *irc.FoldMap // *channel by name
+	users    *irc.FoldMap // *user by nickname
+	mu       sync.RWMutex
+}
+
+// channel is the internal state of a channel.
+type channel struct {
+	name       string
+	topic      string
+	topicSetBy string
+	topicSetAt time.Time
+	modes      map[byte]string
+	members    *irc.FoldMap // Membership modes (string) by nickname
+}
+
+// user is the internal state of a user.
+type user struct {
+	nick, user, host, realName, account string
+	away                                bool
+}
+
+// NewTracker returns an empty Tracker.
+func NewTracker() *Tracker {
+	t := &Tracker{
+		isupport: irc.NewISupport(),
+	}
+	t.mapping = t.isupport.CaseMapper()
+	t.channels = irc.NewFoldMap(t.mapping)
+	t.users = irc.NewFoldMap(t.mapping)
+	return t
+}
+
+// ISupport returns the server features collected from RPL_ISUPPORT.
+func (t *Tracker) ISupport() *irc.ISupport {
+	return t.isupport
+}
+
+// Nick returns our own nickname.
+func (t *Tracker) Nick() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.me
+}
+
+// SetNick sets our own nickname. This is only needed if the tracker did not
+// receive RPL_WELCOME.
+func (t *Tracker) SetNick(nick string) {
+	t.mu.Lock()
+	t.me = nick
+	t.mu.Unlock()
+}
+
+// IsMe returns true if nick is our own nickname.
+func (t *Tracker) IsMe(nick string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.mapping.Equal(nick, t.me)
+}
+
+// Channel returns a snapshot of a joined channel.
+func (t *Tracker) Channel(name string) (c Channel, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if v, ok := t.channels.Get(name); ok {
+		return v.(*channel).snapshot(), true
+	}
+	return c, false
+}
+
+// Channels returns snapshots of all joined channels, sorted by name.
+func (t *Tracker) Channels() []Channel {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	channels := make([]Channel, 0, t.channels.Len())
+	for _, name := range t.channels.Keys() {
+		v, _ := t.channels.Get(name)
+		channels = append(channels, v.(*channel).snapshot())
+	}
+	return channels
+}
+
+// User returns a snapshot of a user sharing a channel with us.
+func (t *Tracker) User(nick string) (u User, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if v, ok := t.users.Get(nick); ok {
+		return t.userSnapshot(v.(*user)), true
+	}
+	return u, false
+}
+
+// Users returns snapshots of all known users, sorted by nickname.
+func (t *Tracker) Users() []User {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	users := make([]User, 0, t.users.Len())
+	for _, nick := range t.users.Keys() {
+		v, _ := t.users.Get(nick)
+		users = append(users, t.userSnapshot(v.(*user)))
+	}
+	return users
+}
+
+// Update processes a message received from the server. Messages that don't
+// affect channels or users are ignored.
+func (t *Tracker) Update(m *irc.Message) {
+
+	if m == nil {
+		return
+	}
+
+	params := m.Params
+	if len(m.Trailing) > 0 || m.EmptyTrailing {
+		params = append(params[:len(params):len(params)], m.Trailing)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch m.Command {
+
+	case irc.RPL_WELCOME:
+		if len(params) > 0 {
+			t.me = params[0]
+		}
+
+	case irc.RPL_ISUPPORT:
+		t.isupport.Update(m)
+		if mapping := t.isupport.CaseMapper(); mapping != t.mapping {
+			t.remap(mapping)
+		}
+
+	case irc.JOIN:
+		if m.Prefix == nil || len(params) < 1 {
+			break
+		}
+		for _, name := range strings.Split(params[0], ",") {
+			c := t.channel(name)
+			if c == nil && t.mapping.Equal(m.Prefix.Name, t.me) {
+				c = newChannel(name, t.mapping)
+				t.channels.Set(name, c)
+			}
+			if c == nil {
+				continue
+			}
+			// Only users joining a channel we're in are tracked.
+			u := t.touch(m.Prefix)
+			if len(params) >= 3 {
+				// extended-join: JOIN <channel> <account> :<realname>
+				u.account, u.realName = account(params[1]), params[2]
+			}
+			c.members.Set(m.Prefix.Name, "")
+		}
+
+	case irc.PART:
+		if m.Prefix == nil || len(params) < 1 {
+			break
+		}
+		for _, name := range strings.Split(params[0], ",") {
+			t.part(name, m.Prefix.Name)
+		}
+
+	case irc.KICK:
+		if len(params) >= 2 {
+			t.part(params[0], params[1])
+		}
+
+	case irc.QUIT:
+		if m.Prefix == nil {
+			break
+		}
+		t.channels.Range(func(_ string, v interface{}) bool {
+			v.(*channel).members.Delete(m.Prefix.Name)
+			return true
+		})
+		t.users.Delete(m.Prefix.Name)
+
+	case irc.NICK:
+		if m.Prefix == nil || len(params) < 1 {
+			break
+		}
+		old, nick := m.Prefix.Name, params[0]
+		if t.mapping.Equal(old, t.me) {
+			t.me = nick
+		}
+		if v, ok := t.users.Get(old); ok {
+			v.(*user).nick = nick
+			t.users.Rename(old, nick)
+		}
+		t.channels.Range(func(_ string, v interface{}) bool {
+			v.(*channel).members.Rename(old, nick)
+			return true
+		})
+
+	case irc.MODE:
+		if len(params) >= 2 {
+			if c := t.channel(params[0]); c != nil {
+				t.mode(c, params[1:], false)
+			}
+		}
+
+	case irc.RPL_CHANNELMODEIS:
+		if len(params) >= 3 {
+			if c := t.channel(params[1]); c != nil {
+				t.mode(c, params[2:], true)
+			}
+		}
+
+	case irc.TOPIC:
+		if len(params) < 2 {
+			break
+		}
+		if c := t.channel(params[0]); c != nil {
+			c.topic, c.topicSetAt = params[1], time.Now()
+			if m.Prefix != nil {
+				c.topicSetBy = m.Prefix.String()
+			}
+		}
+
+	case irc.RPL_TOPIC:
+		if len(params) >= 3 {
+			if c := t.channel(params[1]); c != nil {
+				c.topic = params[2]
+			}
+		}
+
+	case irc.RPL_NOTOPIC:
+		if len(params) >= 2 {
+			if c := t.channel(params[1]); c != nil {
+				c.topic, c.topicSetBy, c.topicSetAt = "", "", time.Time{}
+			}
+		}
+
+	case irc.RPL_TOPICWHOTIME:
+		if len(params) < 4 {
+			break
+		}
+		if c := t.channel(params[1]); c != nil {
+			c.topicSetBy = params[2]
+			if sec, err := strconv.ParseInt(params[3], 10, 64); err == nil {
+				c.topicSetAt = time.Unix(sec, 0)
+			}
+		}
+
+	case irc.RPL_NAMREPLY:
+		if len(params) < 4 {
+			break
+		}
+		c := t.channel(params[2])
+		if c == nil {
+			break
+		}
+		for _, name := range strings.Fields(params[3]) {
+			modes, rest := t.prefixModes(name)
+			u := t.touch(irc.ParsePrefix(rest))
+			c.members.Set(u.nick, modes)
+		}
+
+	case irc.RPL_WHOREPLY:
+		// <me> <channel> <user> <host> <server> <nick> <flags> :<hopcount> <realname>
+		if len(params) < 8 {
+			break
+		}
+		// Replies about users not sharing a channel with us are ignored.
+		c := t.channel(params[1])
+		if _, known := t.users.Get(params[5]); c == nil && !known {
+			break
+		}
+		u := t.touch(&irc.Prefix{Name: params[5], User: params[2], Host: params[3]})
+		if i := strings.IndexByte(params[7], ' '); i >= 0 {
+			u.realName = params[7][i+1:]
+		}
+		flags := params[6]
+		if len(flags) > 0 {
+			u.away = flags[0] == 'G'
+		}
+		if c != nil {
+			modes, _ := t.prefixModes(strings.TrimLeft(flags, "HG*"))
+			c.members.Set(u.nick, modes)
+		}
+
+	case irc.AWAY:
+		if m.Prefix != nil {
+			if v, ok := t.users.Get(m.Prefix.Name); ok {
+				v.(*user).away = len(params) > 0 && len(params[0]) > 0
+			}
+		}
+
+	case "ACCOUNT":
+		if m.Prefix != nil && len(params) > 0 {
+			if v, ok := t.users.Get(m.Prefix.Name); ok {
+				v.(*user).account = account(params[0])
+			}
+		}
+
+	case "CHGHOST":
+		if m.Prefix != nil && len(params) >= 2 {
+			if v, ok := t.users.Get(m.Prefix.Name); ok {
+				v.(*user).user, v.(*user).host = params[0], params[1]
+			}
+		}
+
+	}
+}
+
+// channel returns a joined channel, or nil.
+func (t *Tracker) channel(name string) *channel {
+	if v, ok := t.channels.Get(name); ok {
+		return v.(*channel)
+	}
+	return nil
+}
+
+// touch returns the user for a prefix, creating it if needed, and updates
+// the username and hostname if known.
+func (t *Tracker) touch(p *irc.Prefix) *user {
+	var u *user
+	if v, ok := t.users.Get(p.Name); ok {
+		u = v.(*user)
+	} else {
+		u = &user{nick: p.Name}
+		t.users.Set(p.Name, u)
+	}
+	if len(p.User) > 0 {
+		u.user = p.User
+	}
+	if len(p.Host) > 0 {
+		u.host = p.Host
+	}
+	return u
+}
+
+// part removes nick from a channel, or the channel if nick is us.
+func (t *Tracker) part(name, nick string) {
+	c := t.channel(name)
+	if c == nil {
+		return
+	}
+	if t.mapping.Equal(nick, t.me) {
+		t.channels.Delete(name)
+		c.members.Range(func(member string, _ interface{}) bool {
+			t.prune(member)
+			return true
+		})
+		return
+	}
+	c.members.Delete(nick)
+	t.prune(nick)
+}
+
+// prune forgets a user that no longer shares a channel with us.
+func (t *Tracker) prune(nick string) {
+	shared := false
+	t.channels.Range(func(_ string, v interface{}) bool {
+		shared = v.(*channel).members.Has(nick)
+		return !shared
+	})
+	if !shared {
+		t.users.Delete(nick)
+	}
+}
+
+// prefixModes splits the membership prefix symbols from a name in
+// RPL_NAMREPLY and returns the corresponding modes, sorted by rank.
+func (t *Tracker) prefixModes(name string) (modes, rest string) {
+	all, symbols := t.isupport.Prefix()
+	i := 0
+	for i < len(name) && strings.IndexByte(symbols, name[i]) >= 0 {
+		i++
+	}
+	for j := 0; j < len(all); j++ {
+		if strings.IndexByte(name[:i], symbols[j]) >= 0 {
+			modes = modes + all[j:j+1]
+		}
+	}
+	return modes, name[i:]
+}
+
+// mode applies a mode string with parameters to a channel. If reset is true,
+// all channel modes are cleared first, as for RPL_CHANNELMODEIS.
+func (t *Tracker) mode(c *channel, params []string, reset bool) {
+
+	if reset {
+		c.modes = make(map[byte]string)
+	}
+
+	chanModes := t.isupport.ChanModes()
+	prefixes, _ := t.isupport.Prefix()
+
+	// Changes parsed before a missing parameter are still applied.
+	changes, _ := irc.ParseModeChange(params, chanModes)
+
+	for _, change := range changes {
+		switch {
+		case strings.IndexByte(chanModes.Prefix, change.Mode) >= 0:
+			if v, ok := c.members.Get(change.Param); ok {
+				c.members.Set(change.Param, rankModes(prefixes, v.(string), change.Mode, change.Add))
+			}
+		case strings.IndexByte(chanModes.List, change.Mode) >= 0:
+			// List modes such as bans are not tracked.
+		case change.Add:
+			c.modes[change.Mode] = change.Param
+		default:
+			delete(c.modes, change.Mode)
+		}
+	}
+}
+
+// remap switches to a different casemapping.
+func (t *Tracker) remap(mapping irc.CaseMapping) {
+	t.mapping = mapping
+	channels, users := irc.NewFoldMap(mapping), irc.NewFoldMap(mapping)
+	t.channels.Range(func(name string, v interface{}) bool {
+		c := v.(*channel)
+		members := irc.NewFoldMap(mapping)
+		c.members.Range(func(nick string, modes interface{}) bool {
+			members.Set(nick, modes)
+			return true
+		})
+		c.members = members
+		channels.Set(name, c)
+		return true
+	})
+	t.users.Range(func(nick string, v interface{}) bool {
+		users.Set(nick, v)
+		return true
+	})
+	t.channels, t.users = channels, users
+}
+
+// userSnapshot returns a copy of u, including shared channels.
+func (t *Tracker) userSnapshot(u *user) User {
+	s := User{
+		Nick:     u.nick,
+		User:     u.user,
+		Host:     u.host,
+		RealName: u.realName,
+		Account:  u.account,
+		Away:     u.away,
+	}
+	t.channels.Range(func(name string, v interface{}) bool {
+		if v.(*channel).members.Has(u.nick) {
+			s.Channels = append(s.Channels, v.(*channel).name)
+		}
+		return true
+	})
+	sort.Strings(s.Channels)
+	return s
+}
+
+// newChannel returns an empty channel.
+func newChannel(name string, mapping irc.CaseMapping) *channel {
+	return &channel{
+		name:    name,
+		modes:   make(map[byte]string),
+		members: irc.NewFoldMap(mapping),
+	}
+}
+
+// snapshot returns a copy of c.
+func (c *channel) snapshot() Channel {
+	s := Channel{
+		Name:       c.name,
+		Topic:      c.topic,
+		TopicSetBy: c.topicSetBy,
+		TopicSetAt: c.topicSetAt,
+		Modes:      make(map[byte]string, len(c.modes)),
+		Members:    make(map[string]string, c.members.Len()),
+	}
+	for mode, arg := range c.modes {
+		s.Modes[mode] = arg
+	}
+	c.members.Range(func(nick string, modes interface{}) bool {
+		s.Members[nick] = modes.(string)
+		return true
+	})
+	return s
+}
+
+// rankModes adds or removes mode from modes, keeping the order of ranks.
+func rankModes(ranks, modes string, mode byte, add bool) (result string) {
+	for i := 0; i < len(ranks); i++ {
+		has := strings.IndexByte(modes, ranks[i]) >= 0
+		if ranks[i] == mode {
+			has = add
+		}
+		if has {
+			result = result + ranks[i:i+1]
+		}
+	}
+	return result
+}
+
+// account returns the account name from extended-join or account-notify,
+// which use "*" for users that are not logged in.
+func account(name string) string {
+	if name == "*" {
+		return ""
+	}
+	return name
+}
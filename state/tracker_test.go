@@ -0,0 +1,151 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package state
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc"
+)
+
+// feed passes raw messages to a new Tracker.
+func feed(t *testing.T, raw ...string) *Tracker {
+	tracker := NewTracker()
+	for _, s := range raw {
+		m, err := irc.ParseMessageStrict(s)
+		if err != nil {
+			t.Fatalf("Invalid test message %q: %s", s, err.Error())
+		}
+		tracker.Update(m)
+	}
+	return tracker
+}
+
+var welcome = []string{
+	":irc.test 001 me :Welcome",
+	":irc.test 005 me PREFIX=(qov)~@+ CHANMODES=beI,k,l,imnpst CASEMAPPING=rfc1459 :are supported by this server",
+	":me!u@h JOIN #Chan",
+	":irc.test 332 me #chan :Hello world",
+	":irc.test 333 me #chan setter!u@h 1500000000",
+	":irc.test 353 me = #chan :me @+Alice bob",
+	":irc.test 366 me #chan :End of /NAMES list.",
+}
+
+func TestTracker_join(t *testing.T) {
+	tracker := feed(t, welcome...)
+
+	c, ok := tracker.Channel("#CHAN")
+	if !ok {
+		t.Fatal("Channel should be tracked after JOIN.")
+	}
+
+	expected := Channel{
+		Name:       "#Chan",
+		Topic:      "Hello world",
+		TopicSetBy: "setter!u@h",
+		TopicSetAt: time.Unix(1500000000, 0),
+		Modes:      map[byte]string{},
+		Members:    map[string]string{"me": "", "Alice": "ov", "bob": ""},
+	}
+
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Channel looks wrong: %#v", c)
+	}
+
+	if u, ok := tracker.User("ALICE"); !ok || !reflect.DeepEqual(u.Channels, []string{"#Chan"}) {
+		t.Errorf("User looks wrong: %#v", u)
+	}
+}
+
+func TestTracker_changes(t *testing.T) {
+	tracker := feed(t, append(welcome,
+		":me!u@h JOIN #other",
+		":bob!b@host JOIN #other",
+		":op!o@h MODE #chan +kl-o+q secret 10 alice bob",
+		":bob!b@host NICK Robert",
+		":alice!a@h PART #chan :bye",
+		":op!o@h KICK #other Robert :out",
+		":setter!u@h TOPIC #chan :New topic",
+		":me!u@h NICK self",
+	)...)
+
+	c, _ := tracker.Channel("#chan")
+
+	if !reflect.DeepEqual(c.Members, map[string]string{"self": "", "Robert": "q"}) {
+		t.Errorf("Wrong members: %#v", c.Members)
+	}
+	if c.Key() != "secret" || c.Modes['l'] != "10" {
+		t.Errorf("Wrong modes: %#v", c.Modes)
+	}
+	if c.Topic != "New topic" || c.TopicSetBy != "setter!u@h" {
+		t.Errorf("Wrong topic: %s by %s", c.Topic, c.TopicSetBy)
+	}
+
+	if _, ok := tracker.User("alice"); ok {
+		t.Error("Users should be forgotten when they no longer share a channel.")
+	}
+	if u, ok := tracker.User("robert"); !ok || u.Host != "host" || !reflect.DeepEqual(u.Channels, []string{"#Chan"}) {
+		t.Errorf("User looks wrong after NICK: %#v", u)
+	}
+	if tracker.Nick() != "self" || !tracker.IsMe("SELF") {
+		t.Errorf("Own nickname should change: %s", tracker.Nick())
+	}
+
+	tracker.Update(irc.ParseMessage(":self!u@h PART #chan"))
+	tracker.Update(irc.ParseMessage(":robert!b@host QUIT :gone"))
+
+	if channels := tracker.Channels(); len(channels) != 1 || channels[0].Name != "#other" {
+		t.Errorf("Wrong channels: %#v", channels)
+	}
+	if users := tracker.Users(); len(users) != 1 || users[0].Nick != "self" {
+		t.Errorf("Wrong users: %#v", users)
+	}
+}
+
+func TestTracker_who(t *testing.T) {
+	tracker := feed(t, append(welcome,
+		":irc.test 324 me #chan +ntk key",
+		":irc.test 352 me #chan ~b host irc.test bob G@ :0 Bob Smith",
+		":bob!~b@host ACCOUNT bobby",
+	)...)
+
+	c, _ := tracker.Channel("#chan")
+
+	if !reflect.DeepEqual(c.Modes, map[byte]string{'n': "", 't': "", 'k': "key"}) {
+		t.Errorf("Wrong modes: %#v", c.Modes)
+	}
+	if c.Members["bob"] != "o" {
+		t.Errorf("Wrong membership modes: %q", c.Members["bob"])
+	}
+
+	u, _ := tracker.User("bob")
+
+	if u.RealName != "Bob Smith" || !u.Away || u.User != "~b" || u.Account != "bobby" {
+		t.Errorf("User looks wrong: %#v", u)
+	}
+}
+
+func TestTracker_strangers(t *testing.T) {
+	tracker := feed(t,
+		":irc.test 001 me :Welcome",
+		":irc.test 352 me #other ~s host irc.test stranger H :0 Stranger",
+		":stranger!s@host JOIN #other",
+	)
+
+	if users := tracker.Users(); len(users) != 0 {
+		t.Errorf("Users not sharing a channel should not be tracked: %#v", users)
+	}
+
+	// WHO replies still update users we know about.
+	tracker = feed(t, append(welcome,
+		":irc.test 352 me * ~b host irc.test bob G :0 Bob Smith",
+	)...)
+
+	if u, _ := tracker.User("bob"); u.RealName != "Bob Smith" || !u.Away {
+		t.Errorf("User looks wrong: %#v", u)
+	}
+}
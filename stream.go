@@ -6,9 +6,13 @@ package irc
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"net"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // Messages are delimited with CR and LF line endings,
@@ -16,6 +20,10 @@ import (
 // during message parsing.
 const delim byte = '\n'
 
+// Default maximum line length accepted by a Decoder: the tags section and a
+// message of 512 bytes, including CR and LF.
+const maxLineLength = maxTagLength + maxLength + 2
+
 var endline = []byte("\r\n")
 
 // A Conn represents an IRC network protocol connection.
@@ -24,7 +32,15 @@ type Conn struct {
 	Encoder
 	Decoder
 
-	conn io.ReadWriteCloser
+	conn      io.ReadWriteCloser
+	keepalive *keepalive
+	mu        sync.Mutex
+
+	// Set by DialWithConfig.
+	host   string
+	port   int
+	secure bool
+	sts    STSStore
 }
 
 // NewConn returns a new Conn using rwc for I/O.
@@ -35,6 +51,7 @@ func NewConn(rwc io.ReadWriteCloser) *Conn {
 		},
 		Decoder: Decoder{
 			reader: bufio.NewReader(rwc),
+			source: rwc,
 		},
 		conn: rwc,
 	}
@@ -52,45 +69,268 @@ func Dial(addr string) (*Conn, error) {
 	return NewConn(c), nil
 }
 
-// Close closes the underlying ReadWriteCloser.
+// Close closes the underlying ReadWriteCloser and stops the keepalive.
 func (c *Conn) Close() error {
+	if k := c.getKeepalive(); k != nil {
+		k.close()
+	}
 	return c.conn.Close()
 }
 
+// Decode attempts to read a single Message from the connection.
+//
+// Works like Decoder.Decode, but also takes care of the keepalive when it is
+// enabled. See StartKeepalive.
+func (c *Conn) Decode() (m *Message, err error) {
+	return c.DecodeContext(context.Background())
+}
+
+// DecodeContext is like Decode, but gives up when ctx is done.
+// See Decoder.DecodeContext.
+func (c *Conn) DecodeContext(ctx context.Context) (m *Message, err error) {
+	m, err = c.Decoder.DecodeContext(ctx)
+
+	k := c.getKeepalive()
+	if k == nil {
+		return
+	}
+
+	if err != nil {
+		if kerr := k.error(); kerr != nil {
+			err = kerr
+		}
+		return
+	}
+
+	if m != nil {
+		k.handle(c, m)
+	}
+
+	return
+}
+
 // A Decoder reads Message objects from an input stream.
 type Decoder struct {
-	reader *bufio.Reader
-	line   string
-	mu     sync.Mutex
+	// When set to true, Decode uses ParseMessageStrict instead of
+	// ParseMessage and returns a *ParseError for invalid messages. Otherwise
+	// invalid messages are returned as nil without error.
+	Strict bool
+
+	// Maximum length of a line, including CR and LF. Defaults to 8703 bytes:
+	// 512 for the message and 8191 for tags.
+	MaxLineLength int
+
+	// Parameters that are not valid UTF-8 are converted from this
+	// Charset, if set. For messages to or from targets in TargetCharsets,
+	// the Charset set for that target is used instead. Valid UTF-8 is never
+	// converted, so targets can switch to UTF-8 at any time.
+	Charset        Charset
+	TargetCharsets *CharsetMap
+
+	reader  *bufio.Reader
+	source  io.Reader
+	line    string
+	partial string           // Start of a line interrupted by a deadline.
+	discard bool             // Skipping the rest of a line that is too long.
+	pending chan decodedLine // Read that outlived its DecodeContext call.
+	mu      sync.Mutex
+}
+
+// decodedLine is the result of reading a line in the background.
+type decodedLine struct {
+	line string
+	err  error
 }
 
 // NewDecoder returns a new Decoder that reads from r.
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
 		reader: bufio.NewReader(r),
+		source: r,
 	}
 }
 
 // Decode attempts to read a single Message from the stream.
 //
-// Returns a non-nil error if the read failed.
+// Returns a non-nil error if the read failed. Empty lines are skipped.
+// Invalid messages are returned as nil without error, like before, unless
+// Strict is set. In that case they result in a *ParseError, after which the
+// next message can be decoded as usual.
+//
+// Lines longer than MaxLineLength are invalid too, reported as ErrLineTooLong
+// in strict mode. The rest of such a line is discarded without buffering it.
 func (dec *Decoder) Decode() (m *Message, err error) {
+	return dec.DecodeContext(context.Background())
+}
+
+// DecodeContext is like Decode, but returns ctx.Err() when ctx is done
+// before a complete message was read.
+//
+// If the underlying reader has a SetReadDeadline method, like net.Conn, it is
+// used to interrupt the read. Its deadline is cleared afterwards. Other readers
+// can't be interrupted, the read continues in the background and its result
+// is returned by the next call to Decode. No data is lost in either case.
+func (dec *Decoder) DecodeContext(ctx context.Context) (m *Message, err error) {
 
-	dec.mu.Lock()
-	dec.line, err = dec.reader.ReadString(delim)
-	dec.mu.Unlock()
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	var line string
+
+	for {
+		dec.mu.Lock()
+		line, err = dec.readLine(ctx)
+		dec.line = line
+		dec.mu.Unlock()
+
+		if _, invalid := err.(*ParseError); invalid && !dec.Strict {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip empty lines.
+		if len(strings.TrimRight(line, "\r\n")) > 0 {
+			break
+		}
+	}
+
+	if !dec.Strict {
+		m = ParseMessage(line)
+	} else if m, err = ParseMessageStrict(line); err != nil {
 		return nil, err
 	}
 
-	return ParseMessage(dec.line), nil
+	if m == nil {
+		return nil, nil
+	}
+
+	if utf8.ValidString(line) {
+		return m, nil
+	}
+	if cs := dec.TargetCharsets.lookup(m); cs != nil {
+		return transcode(m, cs.ToUTF8, false)
+	}
+	if dec.Charset != nil {
+		return transcode(m, dec.Charset.ToUTF8, false)
+	}
+
+	return m, nil
+}
+
+// readLine reads the next line, honouring ctx. The caller holds dec.mu.
+func (dec *Decoder) readLine(ctx context.Context) (string, error) {
+
+	d, deadline := dec.source.(interface {
+		SetReadDeadline(time.Time) error
+	})
+
+	switch {
+
+	// Finish the read started by an earlier call first.
+	case dec.pending != nil:
+
+	// Nothing to cancel.
+	case ctx.Done() == nil:
+		return dec.read()
+
+	case deadline:
+		stop := watchDeadline(ctx, d.SetReadDeadline)
+		line, err := dec.read()
+		stop()
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return line, err
+
+	default:
+		pending := make(chan decodedLine, 1)
+		go func() {
+			line, err := dec.read()
+			pending <- decodedLine{line, err}
+		}()
+		dec.pending = pending
+	}
+
+	select {
+	case r := <-dec.pending:
+		dec.pending = nil
+		return r.line, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// read reads a single line, keeping incomplete lines for the next call.
+func (dec *Decoder) read() (string, error) {
+
+	limit := dec.MaxLineLength
+	if limit <= 0 {
+		limit = maxLineLength
+	}
+
+	for {
+		chunk, err := dec.reader.ReadSlice(delim)
+
+		if dec.discard {
+			switch err {
+			case nil:
+				dec.discard = false
+			case bufio.ErrBufferFull:
+			default:
+				return "", err
+			}
+			continue
+		}
+
+		if len(dec.partial)+len(chunk) > limit {
+			raw := dec.partial + string(chunk)
+			if len(raw) > limit {
+				raw = raw[:limit]
+			}
+			dec.partial = ""
+			dec.discard = err != nil
+			return "", &ParseError{raw, limit, ErrLineTooLong}
+		}
+
+		dec.partial = dec.partial + string(chunk)
+
+		switch err {
+		case nil:
+			line := dec.partial
+			dec.partial = ""
+			return line, nil
+		case bufio.ErrBufferFull:
+		default:
+			return "", err
+		}
+	}
 }
 
 // An Encoder writes Message objects to an output stream.
 type Encoder struct {
+	// Controls how Encode deals with messages containing CR, LF or NUL bytes
+	// and other invalid parameters. The default is to reject them.
+	Sanitize SanitizeMode
+
+	// When positive, Encode splits PRIVMSG and NOTICE messages that would
+	// exceed this length when relayed. See SplitMessage.
+	SplitLength int
+
+	// When set, messages are delayed to avoid flooding the server.
+	// See RateLimiter.
+	RateLimiter *RateLimiter
+
+	// When set, parameters are converted from UTF-8 to this Charset. Messages
+	// to targets in TargetCharsets use the Charset set for that target.
+	Charset        Charset
+	TargetCharsets *CharsetMap
+
 	writer io.Writer
 	mu     sync.Mutex
+	dmu    sync.Mutex // Serializes write deadlines.
 }
 
 // NewEncoder returns a new Encoder that writes to w.
@@ -100,14 +340,101 @@ func NewEncoder(w io.Writer) *Encoder {
 	}
 }
 
+// EncodeContext is like Encode, but gives up when ctx is done.
+//
+// If the underlying writer has a SetWriteDeadline method, like net.Conn, it is
+// used to interrupt the write and cleared afterwards. Other writers can't be
+// interrupted, ctx is only checked before writing.
+//
+// An interrupted write may have sent part of a message, the connection
+// should be closed.
+func (enc *Encoder) EncodeContext(ctx context.Context, m *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return enc.encode(ctx, m)
+}
+
 // Encode writes the IRC encoding of m to the stream.
 //
 // This method may be used from multiple goroutines.
 //
 // Returns an non-nil error if the write to the underlying stream stopped early.
-func (enc *Encoder) Encode(m *Message) (err error) {
+// Messages that could inject additional commands are not written, a
+// *ValidationError is returned instead. See Message.Validate.
+func (enc *Encoder) Encode(m *Message) error {
+	return enc.encode(context.Background(), m)
+}
+
+// encode implements Encode and EncodeContext.
+func (enc *Encoder) encode(ctx context.Context, m *Message) (err error) {
+
+	if enc.Sanitize != SanitizeNone {
+		m = m.Sanitized(enc.Sanitize)
+	}
+
+	if err = m.Validate(); err != nil {
+		return
+	}
+
+	parts := []*Message{m}
+	if enc.SplitLength > 0 && (m.Command == PRIVMSG || m.Command == NOTICE) {
+		parts = SplitMessage(m, enc.SplitLength)
+	}
+
+	// Messages are split before converting, so they're split on rune
+	// boundaries.
+	cs := enc.TargetCharsets.lookup(m)
+	if cs == nil {
+		cs = enc.Charset
+	}
 
-	_, err = enc.Write(m.Bytes())
+	priority := isPriority(m.Command)
+
+	for _, part := range parts {
+		if cs != nil {
+			if part, err = transcode(part, cs.FromUTF8, true); err != nil {
+				return
+			}
+		}
+		if err = enc.write(ctx, part.Bytes(), priority); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// write waits for the rate limiter and writes a single message, using a
+// write deadline to honour ctx if possible.
+func (enc *Encoder) write(ctx context.Context, p []byte, priority bool) (err error) {
+
+	if enc.RateLimiter != nil {
+		if err = enc.RateLimiter.Wait(ctx, len(p), priority); err != nil {
+			return
+		}
+	}
+
+	d, ok := enc.writer.(interface {
+		SetWriteDeadline(time.Time) error
+	})
+	if !ok || ctx.Done() == nil {
+		_, err = enc.writeLine(p)
+		return
+	}
+
+	// Deadlines apply to the whole connection, don't let concurrent calls
+	// clear each other's deadline.
+	enc.dmu.Lock()
+	defer enc.dmu.Unlock()
+
+	stop := watchDeadline(ctx, d.SetWriteDeadline)
+	_, err = enc.writeLine(p)
+	stop()
+
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
 
 	return
 }
@@ -117,8 +444,21 @@ func (enc *Encoder) Encode(m *Message) (err error) {
 // This method can be used simultaneously from multiple goroutines,
 // it guarantees to serialize access. However, writing a single IRC message
 // using multiple Write calls will cause corruption.
+//
+// Writes are delayed by the RateLimiter, if set.
 func (enc *Encoder) Write(p []byte) (n int, err error) {
 
+	if enc.RateLimiter != nil {
+		m := ParseMessage(string(p))
+		enc.RateLimiter.Wait(context.Background(), len(p), m != nil && isPriority(m.Command))
+	}
+
+	return enc.writeLine(p)
+}
+
+// writeLine writes p followed by CR+LF.
+func (enc *Encoder) writeLine(p []byte) (n int, err error) {
+
 	enc.mu.Lock()
 	n, err = enc.writer.Write(p)
 
@@ -132,3 +472,30 @@ func (enc *Encoder) Write(p []byte) (n int, err error) {
 
 	return
 }
+
+// watchDeadline moves the deadline to the past using set when ctx is done.
+// The deadline of ctx itself is not used, so the context error is always set
+// when the deadline interrupts I/O.
+//
+// The returned function must be called to stop watching ctx, it clears the
+// deadline.
+func watchDeadline(ctx context.Context, set func(time.Time) error) (stop func()) {
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			set(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+		set(time.Time{})
+	}
+}
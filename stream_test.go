@@ -6,12 +6,15 @@ package irc
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"io"
 	"log"
+	"net"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // We use the Dial function as a simple shortcut for connecting to an IRC server using a standard TCP socket.
@@ -101,3 +104,116 @@ func TestEncoder_Encode(t *testing.T) {
 	}
 
 }
+
+func TestDecoder_DecodeContext(t *testing.T) {
+	reader, writer := io.Pipe()
+	dec := NewDecoder(reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := dec.DecodeContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// The abandoned read should deliver its message to the next call.
+	go writer.Write([]byte("PING :abc\r\n"))
+
+	if m, err := dec.Decode(); err != nil || m.String() != "PING :abc" {
+		t.Errorf("Unexpected result: %v %v", m, err)
+	}
+}
+
+func TestDecoder_DecodeContext_deadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	dec := NewDecoder(client)
+
+	go server.Write([]byte("PING :a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := dec.DecodeContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// The start of the interrupted line is kept.
+	go server.Write([]byte("bc\r\n"))
+
+	if m, err := dec.Decode(); err != nil || m.String() != "PING :abc" {
+		t.Errorf("Unexpected result: %v %v", m, err)
+	}
+}
+
+func TestEncoder_EncodeContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	enc := NewEncoder(client)
+	m := &Message{Command: PING, Trailing: "abc"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := enc.EncodeContext(ctx, m); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// Nobody reads from the pipe, so the write blocks until the deadline.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := enc.EncodeContext(ctx, m); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDecoder_Decode_lineTooLong(t *testing.T) {
+	long := "PRIVMSG #go :" + strings.Repeat("a", 100)
+	input := strings.NewReader(long + "\r\nPING :1\r\n" + strings.Repeat("b", 5000) + "\r\nPING :2\r\n")
+
+	dec := NewDecoder(input)
+	dec.MaxLineLength = 64
+	dec.Strict = true
+
+	_, err := dec.Decode()
+	if perr, ok := err.(*ParseError); !ok || perr.Err != ErrLineTooLong || perr.Raw != long[:64] {
+		t.Errorf("Expected ErrLineTooLong, got %v", err)
+	}
+
+	if m, err := dec.Decode(); err != nil || m.String() != "PING :1" {
+		t.Errorf("Decoding should continue after a long line, got %v %v", m, err)
+	}
+
+	// Lines longer than the read buffer are discarded too.
+	if _, err = dec.Decode(); err == nil {
+		t.Errorf("Expected ErrLineTooLong, got nil")
+	}
+
+	if m, err := dec.Decode(); err != nil || m.String() != "PING :2" {
+		t.Errorf("Decoding should continue after a long line, got %v %v", m, err)
+	}
+
+	// Lines up to the default limit are accepted.
+	tags := "@a=" + strings.Repeat("x", maxTagLength-5) + " "
+	dec = NewDecoder(strings.NewReader(tags + "PING :" + strings.Repeat("c", maxLength-6) + "\r\n"))
+
+	if m, err := dec.Decode(); err != nil || m == nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Long lines are invalid messages without error by default.
+	dec = NewDecoder(strings.NewReader(long + "\r\nPING :1\r\n"))
+	dec.MaxLineLength = 64
+
+	if m, err := dec.Decode(); m != nil || err != nil {
+		t.Errorf("Expected nil without error, got %v %v", m, err)
+	}
+	if m, err := dec.Decode(); err != nil || m.String() != "PING :1" {
+		t.Errorf("Decoding should continue after a long line, got %v %v", m, err)
+	}
+}
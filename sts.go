@@ -0,0 +1,268 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capability used to advertise a Strict Transport Security policy.
+const capSTS = "sts"
+
+// Various constants used for parsing STS policies.
+const (
+	stsSeparator byte = 0x2C // Separates keys (,)
+	stsValue     byte = 0x3D // Separates key and value (=)
+
+	stsPort     = "port"
+	stsDuration = "duration"
+	stsPreload  = "preload"
+)
+
+// ErrInvalidSTSPolicy is returned for STS policies with invalid values.
+// Clients must ignore such policies.
+var ErrInvalidSTSPolicy = errors.New("irc: invalid STS policy")
+
+// STSPolicy represents an IRCv3 Strict Transport Security policy.
+// See https://ircv3.net/specs/extensions/sts
+//
+//    sts=port=6697,duration=2592000,preload
+//
+// Servers advertise the TLS port on insecure connections, and how long the
+// policy should be remembered on secure connections.
+type STSPolicy struct {
+	Port     int           // TLS port, zero if not advertised
+	Duration time.Duration // How long to remember the policy, -1 if not advertised
+	Preload  bool          // Server agrees to be on preload lists
+	Expires  time.Time     // When a persisted policy expires
+}
+
+// ParseSTSPolicy parses the value of the sts capability.
+//
+// Unknown keys are ignored. Returns ErrInvalidSTSPolicy if the port or
+// duration is invalid.
+func ParseSTSPolicy(value string) (*STSPolicy, error) {
+	p := &STSPolicy{Duration: -1}
+
+	for _, item := range strings.Split(value, string(stsSeparator)) {
+		key, val := item, ""
+		if i := indexByte(item, stsValue); i >= 0 {
+			key, val = item[:i], item[i+1:]
+		}
+
+		switch key {
+		case stsPort:
+			port, err := strconv.Atoi(val)
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, ErrInvalidSTSPolicy
+			}
+			p.Port = port
+		case stsDuration:
+			seconds, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || seconds < 0 {
+				return nil, ErrInvalidSTSPolicy
+			}
+			p.Duration = time.Duration(seconds) * time.Second
+		case stsPreload:
+			p.Preload = true
+		}
+	}
+
+	return p, nil
+}
+
+// Expired returns true if a persisted policy should no longer be used.
+func (p *STSPolicy) Expired() bool {
+	return !time.Now().Before(p.Expires)
+}
+
+// STSStore persists STS policies, keyed by lowercase hostname.
+//
+// Implementations must be safe for concurrent use.
+type STSStore interface {
+	// Load returns the policy stored for host, or nil if there is none.
+	Load(host string) (*STSPolicy, error)
+
+	// Store saves the policy for host. A nil policy removes it.
+	Store(host string, policy *STSPolicy) error
+}
+
+// MemorySTSStore keeps STS policies in memory.
+type MemorySTSStore struct {
+	policies map[string]STSPolicy
+	mu       sync.RWMutex
+}
+
+// NewMemorySTSStore returns an empty MemorySTSStore.
+func NewMemorySTSStore() *MemorySTSStore {
+	return &MemorySTSStore{
+		policies: make(map[string]STSPolicy),
+	}
+}
+
+// Load returns the policy stored for host, or nil if there is none.
+func (s *MemorySTSStore) Load(host string) (*STSPolicy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.policies[host]; ok {
+		return &p, nil
+	}
+	return nil, nil
+}
+
+// Store saves the policy for host. A nil policy removes it.
+func (s *MemorySTSStore) Store(host string, policy *STSPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy == nil {
+		delete(s.policies, host)
+	} else {
+		s.policies[host] = *policy
+	}
+	return nil
+}
+
+// FileSTSStore keeps STS policies in a JSON file, so they survive restarts.
+type FileSTSStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSTSStore returns a FileSTSStore using the file at path. The file
+// is created when the first policy is stored.
+func NewFileSTSStore(path string) *FileSTSStore {
+	return &FileSTSStore{path: path}
+}
+
+// Load returns the policy stored for host, or nil if there is none.
+func (s *FileSTSStore) Load(host string) (*STSPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := policies[host]; ok {
+		return &p, nil
+	}
+	return nil, nil
+}
+
+// Store saves the policy for host. A nil policy removes it.
+func (s *FileSTSStore) Store(host string, policy *STSPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies, err := s.read()
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		delete(policies, host)
+	} else {
+		policies[host] = *policy
+	}
+
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so a crash can't corrupt the store.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// read loads all policies from the file.
+func (s *FileSTSStore) read() (map[string]STSPolicy, error) {
+	policies := make(map[string]STSPolicy)
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return policies, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// STSUpgradeError is returned by Register when the server advertised an STS
+// policy on an insecure connection. The connection is closed, the client
+// should connect again using TLS to Addr.
+type STSUpgradeError struct {
+	Addr string
+}
+
+func (e *STSUpgradeError) Error() string {
+	return "irc: STS policy requires TLS, reconnect to " + e.Addr
+}
+
+// applySTS handles the sts capability advertised by the server, if the
+// connection was dialed with an STSStore.
+func (c *Conn) applySTS(caps *Caps) error {
+	if c.sts == nil {
+		return nil
+	}
+
+	value, ok := caps.Value(capSTS)
+	if !ok {
+		return nil
+	}
+
+	policy, err := ParseSTSPolicy(value)
+	if err != nil {
+		return nil
+	}
+
+	if !c.secure {
+		if policy.Port <= 0 {
+			return nil
+		}
+		c.Close()
+		return &STSUpgradeError{net.JoinHostPort(c.host, strconv.Itoa(policy.Port))}
+	}
+
+	switch {
+	case policy.Duration < 0:
+		return nil
+	case policy.Duration == 0:
+		return c.sts.Store(c.host, nil)
+	}
+
+	// Future connections use the port of this secure connection.
+	policy.Port = c.port
+	policy.Expires = time.Now().Add(policy.Duration)
+
+	return c.sts.Store(c.host, policy)
+}
@@ -0,0 +1,218 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var stsPolicyTests = [...]*struct {
+	value  string
+	policy *STSPolicy
+	err    error
+}{
+	{"port=6697", &STSPolicy{Port: 6697, Duration: -1}, nil},
+	{"duration=300,preload", &STSPolicy{Duration: 300 * time.Second, Preload: true}, nil},
+	{"port=6697,duration=0,unknown=x", &STSPolicy{Port: 6697}, nil},
+	{"port=abc", nil, ErrInvalidSTSPolicy},
+	{"port=70000", nil, ErrInvalidSTSPolicy},
+	{"duration=-1", nil, ErrInvalidSTSPolicy},
+}
+
+func TestParseSTSPolicy(t *testing.T) {
+	for i, test := range stsPolicyTests {
+		policy, err := ParseSTSPolicy(test.value)
+
+		if err != test.err || !reflect.DeepEqual(policy, test.policy) {
+			t.Errorf("Failed to parse STS policy %d:", i)
+			t.Logf("Output: %#v %v", policy, err)
+			t.Logf("Expected: %#v %v", test.policy, test.err)
+		}
+	}
+}
+
+func TestSTSStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	policy := &STSPolicy{Port: 6697, Duration: time.Hour, Expires: time.Now().Add(time.Hour).Round(0)}
+
+	for _, store := range []STSStore{NewMemorySTSStore(), NewFileSTSStore(filepath.Join(dir, "sts.json"))} {
+		if p, err := store.Load("irc.test"); p != nil || err != nil {
+			t.Errorf("%T: Expected no policy, got %v %v", store, p, err)
+		}
+		if err := store.Store("irc.test", policy); err != nil {
+			t.Errorf("%T: Unexpected error: %s", store, err.Error())
+		}
+		if p, err := store.Load("irc.test"); err != nil || p == nil || !p.Expires.Equal(policy.Expires) || p.Port != policy.Port {
+			t.Errorf("%T: Wrong policy: %v %v", store, p, err)
+		}
+		if err := store.Store("irc.test", nil); err != nil {
+			t.Errorf("%T: Unexpected error: %s", store, err.Error())
+		}
+		if p, err := store.Load("irc.test"); p != nil || err != nil {
+			t.Errorf("%T: Expected no policy after removal, got %v %v", store, p, err)
+		}
+	}
+}
+
+// testCertificate creates a self-signed certificate for 127.0.0.1.
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "irc.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// testTLSServer accepts a single TLS connection requiring a client
+// certificate, and sends the CommonName of that certificate in a NOTICE.
+func testTLSServer(t *testing.T, cert tls.Certificate) (port int) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	go func() {
+		conn, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		if tlsConn.Handshake() != nil {
+			return
+		}
+		peer := tlsConn.ConnectionState().PeerCertificates[0]
+		NewEncoder(conn).Encode(&Message{Command: NOTICE, Params: []string{"*"}, Trailing: peer.Subject.CommonName})
+		bufio.NewReader(conn).ReadString('\n')
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestDialWithConfig(t *testing.T) {
+	cert := testCertificate(t)
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	roots.AddCert(leaf)
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+
+	port := testTLSServer(t, cert)
+
+	c, err := DialTLS(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if m, err := c.Decode(); err != nil || m.Trailing != "irc.test" {
+		t.Errorf("Server did not receive client certificate: %v %v", m, err)
+	}
+	c.Close()
+
+	// A stored STS policy upgrades plaintext dials to TLS on the policy port.
+	port = testTLSServer(t, cert)
+
+	store := NewMemorySTSStore()
+	store.Store("127.0.0.1", &STSPolicy{Port: port, Expires: time.Now().Add(time.Hour)})
+
+	c, err = DialWithConfig(context.Background(), "127.0.0.1:1", &DialConfig{
+		TLSConfig: config,
+		STSStore:  store,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !c.secure || c.port != port {
+		t.Errorf("Connection was not upgraded: %v %d", c.secure, c.port)
+	}
+	c.Close()
+}
+
+func TestConn_Register_sts(t *testing.T) {
+	server := func(m *Message, enc *Encoder) {
+		switch {
+		case m.Command == CAP && m.Params[0] == CAP_LS:
+			send(enc, ":irc.test CAP * LS :sts=port=6697,duration=300")
+		case m.Command == CAP && m.Params[0] == CAP_END:
+			send(enc, ":irc.test 001 bot :Welcome", ":irc.test 422 bot :MOTD File is missing")
+		}
+	}
+
+	store := NewMemorySTSStore()
+
+	// Insecure connections must reconnect using TLS.
+	c, _ := testServer(t, server)
+	c.host, c.port, c.sts = "127.0.0.1", 6667, store
+
+	_, err := c.Register(context.Background(), RegistrationConfig{Nick: "bot"})
+
+	if serr, ok := err.(*STSUpgradeError); !ok || serr.Addr != "127.0.0.1:6697" {
+		t.Errorf("Expected *STSUpgradeError, got %v", err)
+	}
+	if p, _ := store.Load("127.0.0.1"); p != nil {
+		t.Errorf("Policy from insecure connection should not be stored: %v", p)
+	}
+
+	// Secure connections persist the policy.
+	c, _ = testServer(t, server)
+	defer c.Close()
+	c.host, c.port, c.secure, c.sts = "127.0.0.1", 6697, true, store
+
+	if _, err = c.Register(context.Background(), RegistrationConfig{Nick: "bot"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	p, _ := store.Load("127.0.0.1")
+	if p == nil || p.Port != 6697 || p.Duration != 300*time.Second || p.Expired() {
+		t.Errorf("Wrong policy stored: %#v", p)
+	}
+}
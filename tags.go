@@ -0,0 +1,257 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Various constants used for formatting IRCv3 message tags.
+const (
+	tagPrefix    byte = 0x40 // Tags section indicator (@)
+	tagSeparator byte = 0x3B // Separates tags (;)
+	tagValue     byte = 0x3D // Separates key and value (=)
+	tagClient    byte = 0x2B // Client-only tag indicator (+)
+	tagVendor    byte = 0x2F // Separates vendor and key name (/)
+
+	maxTagLength = 8191 // Maximum length of the tags section, including '@' and the trailing space.
+)
+
+// Tag represents a single IRCv3 message tag.
+// See https://ircv3.net/specs/extensions/message-tags
+//
+//    <tag>       ::= <key> ['=' <escaped_value>]
+//    <key>       ::= [ <client_prefix> ] [ <vendor> '/' ] <key_name>
+//    <client_prefix> ::= '+'
+//
+// The Value field always contains the unescaped value.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// IsClientOnly returns true if this is a client-only tag, prefixed with '+'.
+func (t Tag) IsClientOnly() bool {
+	return len(t.Key) > 0 && t.Key[0] == tagClient
+}
+
+// Vendor returns the vendor part of the key, or an empty string if the tag
+// is not vendor-specific.
+func (t Tag) Vendor() string {
+	key := strings.TrimPrefix(t.Key, string(tagClient))
+	if i := indexByte(key, tagVendor); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// Name returns the key name, without client prefix or vendor.
+func (t Tag) Name() string {
+	key := strings.TrimPrefix(t.Key, string(tagClient))
+	if i := indexByte(key, tagVendor); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// Len calculates the length of the string representation of this tag.
+func (t Tag) Len() (length int) {
+	length = len(t.Key)
+	if len(t.Value) > 0 {
+		length = length + len(EscapeTagValue(t.Value)) + 1
+	}
+	return
+}
+
+// writeTo is an utility function to write the tag to the bytes.Buffer in Message.Bytes().
+func (t Tag) writeTo(buffer *bytes.Buffer) {
+	buffer.WriteString(t.Key)
+	if len(t.Value) > 0 {
+		buffer.WriteByte(tagValue)
+		buffer.WriteString(EscapeTagValue(t.Value))
+	}
+}
+
+// Tags represents the IRCv3 tags section of a message.
+//
+// Tags keeps the order in which tags were parsed or added, so messages can be
+// re-encoded exactly as they were received.
+type Tags []Tag
+
+// ParseTags takes a string, without the leading '@', and attempts to create
+// a Tags slice. If a key is present more than once, the last value is used.
+func ParseTags(raw string) (t Tags) {
+	for _, item := range strings.Split(raw, string(tagSeparator)) {
+		if len(item) <= 0 {
+			continue
+		}
+		if i := indexByte(item, tagValue); i >= 0 {
+			t.Set(item[:i], UnescapeTagValue(item[i+1:]))
+		} else {
+			t.Set(item, "")
+		}
+	}
+	return t
+}
+
+// Get returns the value of the tag with given key. The ok value is false if
+// the tag is not present.
+func (t Tags) Get(key string) (value string, ok bool) {
+	for _, tag := range t {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// Has returns true if a tag with given key is present.
+func (t Tags) Has(key string) bool {
+	_, ok := t.Get(key)
+	return ok
+}
+
+// Set changes the value of the tag with given key, or appends a new tag if
+// the key is not present yet.
+func (t *Tags) Set(key, value string) {
+	for i := range *t {
+		if (*t)[i].Key == key {
+			(*t)[i].Value = value
+			return
+		}
+	}
+	*t = append(*t, Tag{Key: key, Value: value})
+}
+
+// Del removes the tag with given key.
+//
+// The remaining tags are copied to a new slice, so other slices sharing the
+// same backing array, like a copy of Message.Tags, are not changed.
+func (t *Tags) Del(key string) {
+	for i := range *t {
+		if (*t)[i].Key == key {
+			c := make(Tags, 0, len(*t)-1)
+			c = append(c, (*t)[:i]...)
+			*t = append(c, (*t)[i+1:]...)
+			return
+		}
+	}
+}
+
+// ClientOnly returns the client-only tags, prefixed with '+'.
+func (t Tags) ClientOnly() (c Tags) {
+	for _, tag := range t {
+		if tag.IsClientOnly() {
+			c = append(c, tag)
+		}
+	}
+	return c
+}
+
+// Len calculates the length of the string representation of these tags,
+// excluding the leading '@'.
+func (t Tags) Len() (length int) {
+	for i, tag := range t {
+		if i > 0 {
+			length++
+		}
+		length = length + tag.Len()
+	}
+	return
+}
+
+// Bytes returns a []byte representation of these tags, excluding the leading '@'.
+func (t Tags) Bytes() []byte {
+	buffer := new(bytes.Buffer)
+	t.writeTo(buffer, -1)
+	return buffer.Bytes()
+}
+
+// String returns a string representation of these tags, excluding the leading '@'.
+func (t Tags) String() string {
+	return string(t.Bytes())
+}
+
+// writeTo is an utility function to write the tags to the bytes.Buffer in Message.Bytes().
+//
+// Tags that would make the output longer than limit are discarded, a
+// negative limit disables this check.
+func (t Tags) writeTo(buffer *bytes.Buffer, limit int) {
+	for i, tag := range t[:t.fit(limit)] {
+		if i > 0 {
+			buffer.WriteByte(tagSeparator)
+		}
+		tag.writeTo(buffer)
+	}
+}
+
+// fit returns the number of leading tags that can be written in limit
+// bytes, a negative limit fits all tags.
+func (t Tags) fit(limit int) int {
+	length := 0
+	for i, tag := range t {
+		l := tag.Len()
+		if i > 0 {
+			l++
+		}
+		if limit >= 0 && length+l > limit {
+			return i
+		}
+		length = length + l
+	}
+	return len(t)
+}
+
+var tagEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
+// EscapeTagValue escapes a tag value for use in a raw IRC message.
+func EscapeTagValue(value string) string {
+	return tagEscaper.Replace(value)
+}
+
+// UnescapeTagValue reverses EscapeTagValue.
+//
+// Invalid escape sequences are replaced by the escaped character, a trailing
+// backslash is dropped.
+func UnescapeTagValue(value string) string {
+
+	// Fast path, nothing to unescape.
+	if indexByte(value, '\\') < 0 {
+		return value
+	}
+
+	buffer := new(bytes.Buffer)
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			buffer.WriteByte(value[i])
+			continue
+		}
+		if i++; i >= len(value) {
+			break
+		}
+		switch value[i] {
+		case ':':
+			buffer.WriteByte(';')
+		case 's':
+			buffer.WriteByte(' ')
+		case 'r':
+			buffer.WriteByte('\r')
+		case 'n':
+			buffer.WriteByte('\n')
+		default:
+			buffer.WriteByte(value[i])
+		}
+	}
+
+	return buffer.String()
+}
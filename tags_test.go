@@ -0,0 +1,133 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var tagValueTests = [...]*struct {
+	value   string
+	escaped string
+}{
+	{"", ""},
+	{"plain", "plain"},
+	{"semi;colon", "semi\\:colon"},
+	{"with space", "with\\sspace"},
+	{"back\\slash", "back\\\\slash"},
+	{"line\r\nbreak", "line\\r\\nbreak"},
+	{"\\s", "\\\\s"},
+}
+
+func TestEscapeTagValue(t *testing.T) {
+	for i, test := range tagValueTests {
+		if s := EscapeTagValue(test.value); s != test.escaped {
+			t.Errorf("Failed to escape tag value %d:", i)
+			t.Logf("Output: %q", s)
+			t.Logf("Expected: %q", test.escaped)
+		}
+	}
+}
+
+func TestUnescapeTagValue(t *testing.T) {
+	for i, test := range tagValueTests {
+		if s := UnescapeTagValue(test.escaped); s != test.value {
+			t.Errorf("Failed to unescape tag value %d:", i)
+			t.Logf("Output: %q", s)
+			t.Logf("Expected: %q", test.value)
+		}
+	}
+
+	// Invalid escapes drop the backslash, trailing backslashes are removed.
+	if s := UnescapeTagValue("a\\bc\\"); s != "abc" {
+		t.Errorf("Invalid escapes handled incorrectly: %q", s)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags("a=1;+vendor.example/b;c=;a=2")
+
+	expected := Tags{
+		{Key: "a", Value: "2"},
+		{Key: "+vendor.example/b"},
+		{Key: "c"},
+	}
+
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Failed to parse tags: %#v", tags)
+	}
+}
+
+func TestTag_Parts(t *testing.T) {
+	tag := Tag{Key: "+vendor.example/name"}
+
+	if !tag.IsClientOnly() || tag.Vendor() != "vendor.example" || tag.Name() != "name" {
+		t.Errorf("Failed to split tag key %q", tag.Key)
+	}
+
+	tag = Tag{Key: "time"}
+
+	if tag.IsClientOnly() || tag.Vendor() != "" || tag.Name() != "time" {
+		t.Errorf("Failed to split tag key %q", tag.Key)
+	}
+}
+
+func TestTags_SetDel(t *testing.T) {
+	var tags Tags
+
+	tags.Set("a", "1")
+	tags.Set("b", "2")
+	tags.Set("a", "3")
+	tags.Del("b")
+
+	if v, ok := tags.Get("a"); !ok || v != "3" || len(tags) != 1 || tags.Has("b") {
+		t.Errorf("Unexpected tags: %#v", tags)
+	}
+}
+
+func TestTags_Del_shared(t *testing.T) {
+	tags := Tags{{"a", "1"}, {"b", "2"}, {"c", "3"}}
+	shared := tags
+
+	tags.Del("a")
+
+	if !reflect.DeepEqual(shared, Tags{{"a", "1"}, {"b", "2"}, {"c", "3"}}) {
+		t.Errorf("Del changed a shared slice: %#v", shared)
+	}
+	if !reflect.DeepEqual(tags, Tags{{"b", "2"}, {"c", "3"}}) {
+		t.Errorf("Unexpected tags: %#v", tags)
+	}
+}
+
+func TestMessage_Bytes_tagLimit(t *testing.T) {
+	m := &Message{
+		Command:  "PRIVMSG",
+		Params:   []string{"#channel"},
+		Trailing: strings.Repeat("a", 600),
+	}
+	m.Tags.Set("first", strings.Repeat("x", 5000))
+	m.Tags.Set("second", strings.Repeat("y", 5000))
+
+	s := m.String()
+
+	if !strings.HasPrefix(s, "@first=") || strings.Contains(s, "second") {
+		t.Error("Tags exceeding the tag budget should be discarded.")
+	}
+	if len(s) != len("first=")+5000+2+maxLength {
+		t.Errorf("Unexpected message length %d", len(s))
+	}
+}
+
+func TestMessage_Len_tagLimit(t *testing.T) {
+	m := &Message{Command: "PING", Params: []string{"server"}}
+	m.Tags.Set("first", strings.Repeat("x", 5000))
+	m.Tags.Set("second", strings.Repeat("y", 5000))
+
+	if m.Len() != len(m.Bytes()) {
+		t.Errorf("Len %d should match the written length %d", m.Len(), len(m.Bytes()))
+	}
+}
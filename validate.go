@@ -0,0 +1,200 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidMessage is wrapped by every *ValidationError.
+var ErrInvalidMessage = errors.New("irc: invalid message")
+
+// ValidationError describes why a message can't be encoded safely.
+type ValidationError struct {
+	Field  string // Field containing the problem, such as "Params[1]" or "Trailing"
+	Offset int    // Byte offset in the field where the problem was detected
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s at offset %d: %s", ErrInvalidMessage.Error(), e.Field, e.Offset, e.Reason)
+}
+
+// Unwrap returns ErrInvalidMessage.
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidMessage
+}
+
+// Reasons used in ValidationError.
+const (
+	reasonEmpty   = "must not be empty"
+	reasonIllegal = "contains CR, LF or NUL"
+	reasonSpace   = "contains a space"
+	reasonWord    = "contains a space, CR, LF or NUL"
+	reasonColon   = "starts with a colon"
+	reasonTag     = "contains a character not allowed in tag keys"
+)
+
+// Validate returns a *ValidationError if this message can't be encoded
+// without changing its meaning.
+//
+// Messages containing CR, LF or NUL bytes would allow injecting additional
+// commands when user supplied text is relayed. Middle parameters may not
+// contain spaces or start with a colon, and the command may not be empty.
+func (m *Message) Validate() error {
+
+	for i, tag := range m.Tags {
+		field := "Tags[" + strconv.Itoa(i) + "]"
+		if len(tag.Key) <= 0 {
+			return &ValidationError{field, 0, reasonEmpty}
+		}
+		if j := indexAny(tag.Key, " ;=\r\n\x00"); j >= 0 {
+			return &ValidationError{field, j, reasonTag}
+		}
+		if j := indexByte(tag.Value, 0); j >= 0 {
+			return &ValidationError{field, len(tag.Key) + 1 + j, reasonIllegal}
+		}
+	}
+
+	if m.Prefix != nil {
+		if j := indexAny(m.Prefix.String(), " \r\n\x00"); j >= 0 {
+			return &ValidationError{"Prefix", j, reasonWord}
+		}
+	}
+
+	if len(m.Command) <= 0 {
+		return &ValidationError{"Command", 0, reasonEmpty}
+	}
+	if j := indexAny(m.Command, " \r\n\x00"); j >= 0 {
+		return &ValidationError{"Command", j, reasonWord}
+	}
+	if m.Command[0] == prefix || m.Command[0] == tagPrefix {
+		return &ValidationError{"Command", 0, "starts with a colon or @"}
+	}
+
+	for i, param := range m.Params {
+		field := "Params[" + strconv.Itoa(i) + "]"
+		switch {
+		case len(param) <= 0:
+			return &ValidationError{field, 0, reasonEmpty}
+		case param[0] == prefix:
+			return &ValidationError{field, 0, reasonColon}
+		}
+		if j := indexAny(param, "\r\n\x00"); j >= 0 {
+			return &ValidationError{field, j, reasonIllegal}
+		}
+		if j := indexByte(param, space); j >= 0 {
+			return &ValidationError{field, j, reasonSpace}
+		}
+	}
+
+	if j := indexAny(m.Trailing, "\r\n\x00"); j >= 0 {
+		return &ValidationError{"Trailing", j, reasonIllegal}
+	}
+
+	return nil
+}
+
+// SanitizeMode controls how an Encoder deals with bytes that would make a
+// message invalid.
+type SanitizeMode int
+
+// Sanitize modes for Encoder.
+const (
+	SanitizeNone    SanitizeMode = iota // Reject invalid messages
+	SanitizeStrip                       // Remove offending bytes
+	SanitizeReplace                     // Replace offending bytes
+)
+
+// Sanitized returns a copy of this message with the bytes that Validate
+// complains about removed or replaced, depending on mode.
+//
+// Using SanitizeReplace, CR, LF and NUL are replaced by a space in the
+// trailing parameter and tag values. Elsewhere, offending bytes are replaced
+// by an underscore. Messages without a command or with empty middle parameters
+// stay invalid.
+func (m *Message) Sanitized(mode SanitizeMode) *Message {
+
+	c := *m
+
+	if mode == SanitizeNone {
+		return &c
+	}
+
+	if len(m.Tags) > 0 {
+		c.Tags = make(Tags, len(m.Tags))
+		for i, tag := range m.Tags {
+			c.Tags[i] = Tag{
+				Key:   sanitize(tag.Key, " ;=\r\n\x00", '_', mode),
+				Value: sanitize(tag.Value, "\x00", space, mode),
+			}
+		}
+	}
+
+	if m.Prefix != nil {
+		c.Prefix = &Prefix{
+			Name: sanitize(m.Prefix.Name, " \r\n\x00", '_', mode),
+			User: sanitize(m.Prefix.User, " \r\n\x00", '_', mode),
+			Host: sanitize(m.Prefix.Host, " \r\n\x00", '_', mode),
+		}
+	}
+
+	c.Command = sanitize(m.Command, " \r\n\x00", '_', mode)
+
+	if len(m.Params) > 0 {
+		c.Params = make([]string, len(m.Params))
+		for i, param := range m.Params {
+			param = sanitize(param, " \r\n\x00", '_', mode)
+			for len(param) > 0 && param[0] == prefix {
+				if mode == SanitizeStrip {
+					param = param[1:]
+				} else {
+					param = "_" + param[1:]
+				}
+			}
+			c.Params[i] = param
+		}
+	}
+
+	c.Trailing = sanitize(m.Trailing, "\r\n\x00", space, mode)
+
+	return &c
+}
+
+// sanitize removes or replaces all bytes from chars in s.
+func sanitize(s, chars string, replacement byte, mode SanitizeMode) string {
+
+	// Fast path, nothing to do.
+	if indexAny(s, chars) < 0 {
+		return s
+	}
+
+	buffer := new(bytes.Buffer)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case indexByte(chars, s[i]) < 0:
+			buffer.WriteByte(s[i])
+		case mode == SanitizeReplace:
+			buffer.WriteByte(replacement)
+		}
+	}
+
+	return buffer.String()
+}
+
+// indexAny returns the index of the first byte from chars in s, or -1.
+func indexAny(s, chars string) int {
+	for i := 0; i < len(s); i++ {
+		if indexByte(chars, s[i]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
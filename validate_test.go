@@ -0,0 +1,145 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var validateTests = [...]*struct {
+	message  *Message
+	field    string
+	offset   int
+	strip    *Message
+	replaced *Message
+}{
+	{
+		message: &Message{
+			Command:  PRIVMSG,
+			Params:   []string{"#channel"},
+			Trailing: "Hello\r\nQUIT :bye",
+		},
+		field:  "Trailing",
+		offset: 5,
+		strip: &Message{
+			Command:  PRIVMSG,
+			Params:   []string{"#channel"},
+			Trailing: "HelloQUIT :bye",
+		},
+		replaced: &Message{
+			Command:  PRIVMSG,
+			Params:   []string{"#channel"},
+			Trailing: "Hello  QUIT :bye",
+		},
+	},
+	{
+		message: &Message{
+			Command: JOIN,
+			Params:  []string{"#a b", ":c"},
+		},
+		field:  "Params[0]",
+		offset: 2,
+		strip: &Message{
+			Command: JOIN,
+			Params:  []string{"#ab", "c"},
+		},
+		replaced: &Message{
+			Command: JOIN,
+			Params:  []string{"#a_b", "_c"},
+		},
+	},
+	{
+		message: &Message{
+			Tags:    Tags{{Key: "a b", Value: "c\x00"}},
+			Command: TOPIC,
+		},
+		field:  "Tags[0]",
+		offset: 1,
+		strip: &Message{
+			Tags:    Tags{{Key: "ab", Value: "c"}},
+			Command: TOPIC,
+		},
+		replaced: &Message{
+			Tags:    Tags{{Key: "a_b", Value: "c "}},
+			Command: TOPIC,
+		},
+	},
+	{
+		message: &Message{
+			Params: []string{"#channel"},
+		},
+		field: "Command",
+	},
+	{
+		message: &Message{
+			Command: "MODE",
+			Params:  []string{"#channel", "", "+o"},
+		},
+		field: "Params[1]",
+	},
+}
+
+func TestMessage_Validate(t *testing.T) {
+	for i, test := range validateTests {
+		err, ok := test.message.Validate().(*ValidationError)
+		if !ok {
+			t.Errorf("Message %d should not be valid", i)
+			continue
+		}
+		if err.Field != test.field || err.Offset != test.offset || err.Unwrap() != ErrInvalidMessage {
+			t.Errorf("Wrong error for message %d: %s", i, err.Error())
+		}
+	}
+
+	for i, test := range messageTests {
+		// Skip invalid messages
+		if test.parsed == nil {
+			continue
+		}
+
+		// Empty middle parameters are accepted by ParseMessage, but invalid.
+		if err, ok := test.parsed.Validate().(*ValidationError); ok && err.Reason == reasonEmpty {
+			continue
+		}
+		if err := test.parsed.Validate(); err != nil {
+			t.Errorf("Message %d should be valid: %s", i, err.Error())
+		}
+	}
+}
+
+func TestMessage_Sanitized(t *testing.T) {
+	for i, test := range validateTests {
+		if test.strip != nil {
+			if m := test.message.Sanitized(SanitizeStrip); !reflect.DeepEqual(m, test.strip) {
+				t.Errorf("Failed to strip message %d: %#v", i, m)
+			}
+		}
+		if test.replaced != nil {
+			if m := test.message.Sanitized(SanitizeReplace); !reflect.DeepEqual(m, test.replaced) {
+				t.Errorf("Failed to replace message %d: %#v", i, m)
+			}
+		}
+	}
+}
+
+func TestEncoder_Encode_invalid(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+
+	if err := enc.Encode(validateTests[0].message); err == nil || buffer.Len() > 0 {
+		t.Fatal("Encode should refuse to write messages containing CR or LF.")
+	}
+
+	enc.Sanitize = SanitizeStrip
+
+	if err := enc.Encode(validateTests[0].message); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if buffer.String() != "PRIVMSG #channel :HelloQUIT :bye\r\n" {
+		t.Fatalf("Sanitized message looks wrong: %q", buffer.String())
+	}
+}